@@ -3,15 +3,21 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
-	"sort"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/puellanivis/breton/lib/display/tables"
+	"github.com/puellanivis/allcat/mutate"
 	"github.com/puellanivis/breton/lib/files"
 	"github.com/puellanivis/breton/lib/files/httpfiles"
 	_ "github.com/puellanivis/breton/lib/files/plugins"
@@ -19,9 +25,9 @@ import (
 	_ "github.com/puellanivis/breton/lib/files/sftpfiles"
 	"github.com/puellanivis/breton/lib/glog"
 	flag "github.com/puellanivis/breton/lib/gnuflag"
-	"github.com/puellanivis/breton/lib/metrics"
-	_ "github.com/puellanivis/breton/lib/metrics/http"
 	"github.com/puellanivis/breton/lib/os/process"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 // Version information ready for build-time injection.
@@ -32,132 +38,276 @@ var (
 
 // Flags contains all of the flags defined for the application.
 var Flags struct {
-	Output string `flag:",short=o" desc:"Specifies which URI to write the output to."`
-	Quiet  bool   `flag:",short=q" desc:"If set, supresses output from subprocesses."`
-
-	List       bool   `                           desc:"If set, list files instead of catting them."`
-	UserAgent  string `flag:",default=allcat/1.1" desc:"Which User-Agent string to use."`
-	BufferSize uint   `                           desc:"This is the copy buffer size."`
-	PacketSize uint   `                           desc:"If set, the copy buffer size will be a multiple of this."`
+	Output     string   `flag:",short=o" desc:"Specifies which URI to write the output to."`
+	Append     bool     `desc:"If set, append to the output, rather than truncating it."`
+	Atomic     bool     `desc:"If set, write the output to a temporary file, which only replaces the output once it is complete, and is discarded if any input fails."`
+	Tee        []string `desc:"Also write the output to each of these URIs. May be given multiple times."`
+	OutputMode string   `desc:"If set, the octal permissions to create the output with, e.g. 0600, on backends that support it."`
+	Preserve   bool     `desc:"If set, set the modification time of each output file to that of its input, on backends that support it."`
+	Quiet      bool     `flag:",short=q" desc:"If set, supresses output from subprocesses, and informational logs, such as redirects, and the metrics summary."`
+	ForceTTY   bool     `flag:"force-tty" desc:"If set, read from stdin without a hint, even when it is a terminal."`
+
+	Verbose   verbosity      `flag:",short=V" desc:"Log more of what is done: -V logs what each file does, -VV each step along the way. May be given multiple times."`
+	LogFormat flag.EnumValue `values:"text,json" desc:"The format of logs to stderr: text is the usual glog format, and json is one object per line."`
+
+	LineBuffered bool `desc:"If set, flush the output after every line, so that a streaming input is passed on as each line arrives."`
+
+	Binary flag.EnumValue `values:"warn,force,skip" desc:"What to do with a binary input, one with a NUL byte at its start, when the output is a terminal: warn and skip it, force it out anyway, or skip it silently."`
+
+	CABundle           string `flag:"ca-bundle" desc:"If set, also trust the CA certificates in this PEM file for https requests."`
+	InsecureSkipVerify bool   `desc:"If set, do not verify the certificates of https servers. This is insecure, and is logged as a warning."`
+
+	Credentials string `desc:"If set, read the login and password for each http or sftp host from this .netrc file. (default ~/.netrc, if it exists)"`
+
+	List       bool     `                           desc:"If set, list files instead of catting them."`
+	Resolve    bool     `                           desc:"If set, print each input, what it resolves to after redirects and symlinks, and its size, tab-separated, instead of catting it."`
+	UserAgent  string   `flag:",default=allcat/1.1" desc:"Which User-Agent string to use."`
+	Header     []string `flag:",short=H"            desc:"An extra header to send with http requests, as Name: Value. May be given multiple times."`
+	User       string   `                           desc:"If set, as user:password, authenticate http requests with basic auth, and use the user for sftp. Without a password, it is read from $ALLCAT_PASSWORD, or prompted for."`
+	Bearer     string   `                           desc:"If set, authenticate http requests with this bearer token."`
+	BufferSize uint     `                           desc:"This is the copy buffer size, which also bounds how much output the mutators coalesce into each write. (default 65536, the same as files.Copy)"`
+	PacketSize uint     `                           desc:"If set, the copy buffer size will be a multiple of this."`
+
+	Human           bool           `flag:",short=h" desc:"If set, show sizes in --list output in powers of 1024, like 1.5K, 2.3M, and 4.1G."`
+	Print0          bool           `desc:"If set, output only the path of each --list entry, terminated by a NUL, like find -print0."`
+	ListFormat      flag.EnumValue `values:"table,json,jsonl" desc:"The format of --list output: json is an array of objects, and jsonl is one object per line."`
+	Recursive       bool           `flag:",short=R" desc:"If set, list subdirectories recursively, with each entry named by its path relative to the listed directory."`
+	MaxDepth        int            `desc:"If set, limit --recursive listing to this many levels, where 1 is the listed directory alone."`
+	Sort            flag.EnumValue `values:"name,size,time" desc:"How to sort --list output: by name, by size smallest first, or by modification time oldest first."`
+	ReverseSort     bool           `desc:"If set, reverse the --sort order of --list output."`
+	ShowXattr       bool           `desc:"If set, include the extended attribute names of each entry when listing local files."`
+	ShowXattrValues bool           `desc:"If set, also include the values of extended attributes with --show-xattr."`
+	Name            []string       `desc:"If set, only include --list entries whose base name matches one of these glob patterns. May be given multiple times."`
+	IName           []string       `flag:"iname" desc:"Like --name, but the patterns match regardless of case."`
+	Exclude         []string       `desc:"If set, leave out --list entries whose base name matches any of these glob patterns. May be given multiple times."`
+	MinSize         string         `desc:"If set, only include --list entries of at least this size, in bytes, or with a suffix like 1.5K, 100M, or 4G."`
+	MaxSize         string         `desc:"If set, only include --list entries of at most this size, in bytes, or with a suffix like 1.5K, 100M, or 4G."`
+	NewerThan       string         `desc:"If set, only include --list entries modified after this time: RFC3339, a date like 2024-01-01, or an age like 36h, 7d, or 2w."`
+	OlderThan       string         `desc:"If set, only include --list entries modified before this time: RFC3339, a date like 2024-01-01, or an age like 36h, 7d, or 2w."`
+	Total           bool           `desc:"If set, end a --list table with a summary of how many files it lists, and their total size."`
+	Stat            bool           `desc:"If set, include columns of the extended metadata of each --list entry, such as the ETag, content type, and storage class, where the backend provides them."`
 
 	ShowAll         bool `flag:",short=A" desc:"equivalent to -vET"`
 	NumberNonblank  bool `flag:",short=b" desc:"number nonempty output lines, overrides -n"`
-	ShowEnds        bool `flag:",short=E" desc:"display $ at end of each line"`
+	ShowEnds        bool `flag:",short=E" desc:"display $ at end of each line, before the CR of a CRLF"`
 	Number          bool `flag:",short=n" desc:"number all output lines"`
 	SqueezeBlank    bool `flag:",short=s" desc:"suppress repeated empty output lines"`
 	ShowTabs        bool `flag:",short=T" desc:"display TAB characters as ^I"`
 	ShowNonprinting bool `flag:",short=v" desc:"use ^ and M- notation, except for LFD and TAB"`
+	ShowCR          bool `desc:"display CR characters as ^M"`
+	ExpandTabs      int  `desc:"If set, replace each TAB with spaces up to the next multiple of this many columns, like expand."`
+	UnexpandTabs    int  `desc:"If set, replace runs of spaces reaching a multiple of this many columns with a TAB, like unexpand -a."`
+	UTF8            bool `flag:"utf8" desc:"with -v, pass valid UTF-8 through, and use ^ and M- notation only for control characters and invalid bytes"`
+	NumberOnChange  bool `desc:"number lines like -n, or -b, but leave the number blank on lines repeating the previous line"`
+	FusedLines      bool `desc:"If set, apply -s, -n, -b, and -E in a single pass. (experimental)"`
+
+	StartNumber     int            `desc:"the number to start numbering lines from with -n or -b"`
+	NumberFormat    string         `desc:"the format to number lines with, having exactly one integer verb, where Go escapes are interpreted"`
+	NumberWidth     int            `flag:",default=6" desc:"the width to pad line numbers to"`
+	NumberPad       flag.EnumValue `values:"space,zero" desc:"what to pad line numbers with"`
+	NumberSeparator string         `desc:"the separator to put after line numbers, where Go escapes are interpreted"`
+
+	LineLimit       int    `desc:"If set, truncate each line to this many bytes, not counting -n numbers, or the -E $"`
+	LineLimitMarker string `flag:",default=..." desc:"with --line-limit, the marker to put in place of what is truncated"`
+
+	Hex     bool `desc:"display the output as an xxd-style hexdump of offsets, hex, and printable ASCII, in place of -v"`
+	HexCols int  `flag:",default=16" desc:"with --hex, how many bytes to display on each line"`
 
 	ShowAllButTabs bool `flag:"e" desc:"equivalent to -vE"`
 	ShowAllButEnds bool `flag:"t" desc:"equivalent to -vT"`
 	Ignored        bool `flag:"u" desc:"(ignored)"`
 
-	Metrics        bool   `desc:"If set, publish metrics to the given metrics-port or metrics-address."`
-	MetricsPort    int    `desc:"Which port to publish metrics with. (default auto-assign)"`
-	MetricsAddress string `desc:"Which local address to listen on; overrides metrics-port flag."`
+	LineEnding flag.EnumValue `values:"keep,lf,crlf" desc:"Normalize line endings of the output."`
+	Dos2Unix   bool           `flag:"dos2unix" desc:"equivalent to --line-ending=lf"`
+	Unix2Dos   bool           `flag:"unix2dos" desc:"equivalent to --line-ending=crlf"`
+
+	Translate string `desc:"translate characters like tr, given as SET1:SET2, e.g. a-z:A-Z"`
+	Delete    string `desc:"delete characters in the given set like tr -d, e.g. 0-9"`
+
+	SampleLines string `desc:"If set, output only a sample of lines: 1/N keeps the first of every N lines, and a fraction like 0.01 keeps lines at random."`
+	SampleSeed  int64  `desc:"The random seed to use for --sample-lines fractions. (default random)"`
+
+	Match       string `desc:"If set, output only lines matching this regexp, like grep."`
+	Uniq        bool   `desc:"If set, suppress consecutive identical lines, like uniq."`
+	UniqCount   bool   `desc:"If set, suppress consecutive identical lines, and prefix each with its count, like uniq -c."`
+	NoMatch     string `desc:"If set, output only lines not matching this regexp, like grep -v."`
+	GrepContext int    `flag:"context,short=C" desc:"With --match, also output this many lines of context around each match."`
+	GrepBefore  int    `flag:"before-context" desc:"With --match, also output this many lines of context before each match."`
+	GrepAfter   int    `flag:"after-context" desc:"With --match, also output this many lines of context after each match."`
+
+	Index     string `desc:"If set, print an index of the line numbers and lines matching this regexp to stderr."`
+	IndexOnly bool   `desc:"If set, print only the --index, instead of the content."`
+
+	Metrics           bool   `desc:"If set, publish metrics to the given metrics-port or metrics-address."`
+	MetricsPort       int    `desc:"Which port to publish metrics with. (default auto-assign)"`
+	MetricsAddress    string `desc:"Which local address to listen on, as host:port, tcp:host:port for dual-stack, tcp6:host:port, or unix:/path/to.sock; overrides metrics-port flag."`
+	MetricsRoot       string `flag:",default=/metrics" desc:"Which path to publish metrics on."`
+	MetricsNoRedirect bool   `desc:"If set, do not redirect / to the metrics-root."`
+	MetricsSummary    bool   `desc:"If set, print a summary of the collected metrics to stderr at exit."`
+	MetricsRequired   bool   `desc:"If set, abort if metrics cannot be published, rather than continuing without them."`
+
+	Summary       bool `desc:"If set, print a summary of the run at exit to stderr: total files, bytes, time, average rate, and any failures. With --log-format=json, it is a single line of JSON."`
+	SummaryStdout bool `desc:"With --summary, print the summary to stdout, after all of the output, instead of stderr."`
 
 	Files []string `flag:",short=f" desc:"Read list of files to output from given file(s)."`
-}
+	Null  bool     `flag:",short=0" desc:"If set, the --files lists are NUL-delimited, as from find -print0, and each filename is taken literally."`
 
-func init() {
-	flag.Struct("", &Flags)
-}
+	Follow         bool          `desc:"If set, keep following each file after it has been catted, and output bytes as they are appended, like tail -f, until interrupted."`
+	FollowInterval time.Duration `flag:",default=1s" desc:"How often to poll for growth with --follow."`
 
-var (
-	bwLifetime = metrics.Gauge("bandwidth_lifetime_bps", "bandwidth of the copy to output process (bytes/second)")
-	bwRunning  = metrics.Gauge("bandwidth_running_bps", "bandwidth of the copy to output process (bytes/second)")
-)
+	WatchDir      bool          `desc:"If set, poll the given directories, and cat each new file that appears in them."`
+	WatchInterval time.Duration `flag:",default=1s" desc:"How often to poll directories with --watch-dir."`
+	WatchGrowing  bool          `desc:"If set, with --watch-dir, also cat bytes appended to files after they were first catted."`
 
-// ListFile lists the given dirname to the given io.Writer.
-func ListFile(ctx context.Context, out io.Writer, dirname string) {
-	fi, err := files.List(ctx, dirname)
-	if err != nil {
-		glog.Error("files.List: ", err)
-		return
-	}
+	Shuffle  bool `desc:"If set, process the inputs in a random order."`
+	MaxFiles int  `desc:"If set, process at most this many inputs. (With --shuffle, a random sample of them.)"`
 
-	sort.Slice(fi, func(i, j int) bool {
-		return fi[i].Name() < fi[j].Name()
-	})
+	TarOutput bool `desc:"If set, output a tar stream of all inputs, recursing into directories. Mutators are not applied."`
 
-	var t tables.Table
-	for _, info := range fi {
-		lm := info.ModTime().Format(time.RFC3339)
+	ShellVar string `desc:"If set, output each file as a shell variable assignment of this name, using a here-doc."`
 
-		t = tables.Append(t, info.Mode(), info.Size(), lm, info.Name())
-	}
+	OutputHashed        bool   `desc:"If set, write each file into the --output directory, named by the hash of its content."`
+	OutputHashAlgorithm string `flag:",default=sha256" desc:"Which hash algorithm to use for --output-hashed names."`
+	OutputHashPrefix    string `desc:"A prefix to add to --output-hashed names."`
+	OutputHashSuffix    string `desc:"A suffix to add to --output-hashed names."`
+	OutputTemplate      string `desc:"If set, write each file to its own output, named by this Go template, with the fields .Path, .Dir, .Base, .Ext, .Stem, and .Index, e.g. '{{.Base}}'."`
 
-	tables.Empty.WriteSimple(out, t)
-}
+	Head    int    `desc:"If set, output only the first N lines of each input, and stop reading it there."`
+	Tail    int    `flag:",short=N" desc:"If set, output only the last N lines of each input."`
+	Bytes   string `desc:"If set, output only the bytes START-END of each input, where START is inclusive, END is exclusive, and offsets start at 0. For http, only the range is requested."`
+	Lines   string `desc:"If set, output only the lines START:END of each input, inclusive and counting from 1, like sed's START,ENDp. Either may be omitted."`
+	Reverse bool   `flag:",short=r" desc:"output the lines of each input in reverse order, as tac does. The whole input is read into memory first."`
 
-// CatFile prints the given filename out to the given io.Writer.
-func CatFile(ctx context.Context, out io.Writer, filename string, opts []files.CopyOption) {
-	in, err := files.Open(ctx, filename)
-	if err != nil {
-		glog.Error("files.Open: ", err)
-		return
-	}
-	defer func() {
-		if err := in.Close(); err != nil {
-			glog.Error("input.Close: ", err)
-		}
-	}()
+	Decompress flag.EnumValue `values:"auto,never,always" desc:"Whether to decompress gzip inputs: auto detects them by their magic bytes."`
 
-	printName := filename
-	switch filename {
-	case "", "-", "/dev/stdin":
-	default:
-		if printName = in.Name(); filename != printName {
-			glog.Info("input redirected: ", printName)
-		}
-	}
+	Base64Encode bool `desc:"If set, base64 encode each file."`
+	Base64Decode bool `desc:"If set, base64 decode each file, ignoring any whitespace in it."`
+	Base64URL    bool `flag:"base64-url" desc:"If set, use the URL-safe base64 alphabet for --base64-encode and --base64-decode."`
 
-	if len(printName) > 40 {
-		printName = printName[:40] + "…"
-	}
+	FromCharset string         `desc:"If set, transcode each file from this charset, like latin1 or shift_jis, into UTF-8, or --to-charset."`
+	ToCharset   string         `desc:"If set, transcode the output into this charset, from UTF-8, or --from-charset."`
+	OnInvalid   flag.EnumValue `values:"replace,error,skip" desc:"What to do with bytes that cannot be decoded, or characters that cannot be encoded, with --from-charset or --to-charset."`
 
-	if glog.V(5) {
-		glog.Info("cat file: ", printName)
-	}
+	StripBOM bool `flag:"strip-bom" desc:"If set, drop a UTF-8 byte order mark from the start of each file."`
+	AddBOM   bool `flag:"add-bom" desc:"If set, start the output with a UTF-8 byte order mark."`
 
-	start := time.Now()
+	JSONPretty bool `flag:"json-pretty" desc:"If set, reformat each file of JSON, or JSONL, with indentation."`
+	JSONMinify bool `flag:"json-minify" desc:"If set, reformat each file of JSON, or JSONL, compacted, with one top-level value per line."`
 
-	n, err := files.Copy(ctx, out, in, opts...)
+	Compress      flag.EnumValue `values:",gzip" desc:"If set, compress the output in this format."`
+	CompressLevel int            `flag:",default=-1" desc:"The level to --compress at, from 1 for the fastest, to 9 for the smallest, or -1 for the default."`
 
-	if err != nil && err != io.EOF {
-		glog.Error(err)
+	TrimBytesStart int `desc:"If set, drop this many bytes from the start of each file."`
+	TrimBytesEnd   int `desc:"If set, drop this many bytes from the end of each file."`
 
-		if n > 0 {
-			glog.Errorf("%s: %d bytes copied in %v", printName, n, time.Since(start))
+	MaxBytes           int64 `desc:"If set, read at most this many bytes of each file, and abort the transfer of the rest."`
+	MaxBytesCompressed bool  `desc:"If set, apply --max-bytes to the input as read, rather than after it is decompressed."`
+
+	RateLimit      string         `desc:"If set, limit how fast inputs are read to this many bytes per second, or with a suffix like 500K/s or 2M/s."`
+	RateLimitScope flag.EnumValue `values:"file,total" desc:"Whether --rate-limit applies to each file on its own, or to all files being read at once, like with --jobs."`
+
+	Progress            bool          `desc:"If set, show the progress of each file on stderr."`
+	ProgressMinSize     int64         `desc:"If set, only show progress once a transfer exceeds this many bytes."`
+	ProgressMinDuration time.Duration `desc:"If set, only show progress once a transfer has run longer than this."`
+
+	ByteStats     bool `desc:"If set, instead of the content, print a table of the frequency of each byte value across all inputs."`
+	ByteStatsJSON bool `desc:"If set, print the --byte-stats table as JSON."`
+
+	Count bool `desc:"If set, instead of the content, print the lines, words, and bytes of each input, like wc, with a total if there is more than one."`
+
+	ChunkTiming     bool `desc:"If set, print a summary of the latency between successive reads of each file to stderr."`
+	ChunkTimingJSON bool `desc:"If set, print the --chunk-timing summary as JSON."`
+
+	Frame          flag.EnumValue `values:",newline,nul,length-prefixed" desc:"If set, split input into frames of this format, and output each frame followed by --frame-separator."`
+	FrameSeparator string         `desc:"Separator to output after each frame, Go escapes are interpreted, as is \\0 for a NUL."`
+
+	Extract string `desc:"If set, extract plain text from documents with this text extractor, or \"auto\" to select one by content type."`
+
+	Jobs          uint `flag:",default=1" desc:"How many files to fetch and copy at once, while still outputting them in order."`
+	JobsSpoolSize int  `flag:",default=8388608" desc:"How many bytes of each out of order file to hold in memory with --jobs, before spooling it to a temporary file."`
+
+	Prefetch     bool `desc:"If set, open and start fetching the next file while the current one is still being written out."`
+	PrefetchSize int  `flag:",default=8388608" desc:"How many bytes of the next file to buffer in memory with --prefetch, before waiting for its turn."`
+
+	Checksum    string `desc:"If set, print a checksum manifest using this algorithm (crc32, md5, sha1, sha256, sha512) instead of file contents."`
+	ChecksumCat bool   `desc:"If set with --checksum, output the file contents as usual, and print the checksum manifest to stderr."`
+	Parallel    uint   `flag:",default=1" desc:"How many files to checksum in parallel."`
+
+	VerifyChecksum string        `desc:"If set, verify the input matches this digest (algorithm:hex), downloading it again on a mismatch."`
+	Timeout        time.Duration `desc:"If set, give up on everything still in progress after this long."`
+	StallTimeout   time.Duration `desc:"If set, give up on a file once nothing of it has been copied for this long. Progress is counted per copy buffer."`
+	OpenTimeout    time.Duration `desc:"If set, give up on opening a file after this long, since opening a FIFO blocks until its other end is opened."`
+	FailFast       bool          `desc:"If set, stop processing the remaining inputs at the first one that fails."`
+	Retries        uint          `desc:"How many times to retry a failed open or transfer."`
+	RetryBackoff   time.Duration `flag:",default=1s" desc:"How long to wait before the first retry of a failed open, doubling with each retry."`
+
+	Resume         bool   `desc:"If set, and the --output file is smaller than the input, copy only the rest of the input, appending it to the output."`
+	ResumeChecksum string `desc:"If set with --resume, verify the whole output against this digest (algorithm:hex) once it is complete."`
+}
+
+func init() {
+	Flags.FrameSeparator = `\n`
+	Flags.NumberFormat = `%6d\t`
+	Flags.NumberSeparator = `\t`
+	Flags.StartNumber = 1
+
+	flag.Struct("", &Flags)
+}
+
+// CatFile prints the given filename out to the given io.Writer.
+// Any error is reported as it happens, and is also returned so that the caller may act upon it.
+func CatFile(ctx context.Context, out io.Writer, filename string, opts []files.CopyOption) (err error) {
+	defer func() {
+		// A file truncated by --max-bytes was still copied, as far as it was asked to be.
+		if err != nil && err != errTruncated {
+			filesFailed.WithLabels(labelScheme.WithValue(schemeOf(filename))).Inc()
+			summary.done(filename, err)
+			return
 		}
 
-		return
+		summary.done(filename, nil)
+	}()
+
+	if inputRange != nil {
+		ctx = withRangeRequests(ctx, inputRange)
 	}
 
-	if glog.V(2) {
-		glog.Infof("%s: %d bytes copied in %v", printName, n, time.Since(start))
+	switch filename {
+	case "", "-", "/dev/stdin":
+		// Reading a terminal waits for it to be typed into, which can look like allcat has hung.
+		if isTerminal(os.Stdin) && !Flags.ForceTTY && !Flags.Quiet {
+			logger.Warning("reading from stdin, which is a terminal: end the input with Ctrl-D, or pass --force-tty to silence this hint")
+		}
 	}
-}
 
-// FilelistFromFile reads a list of filenames from a file.
-func FilelistFromFile(ctx context.Context, filename string) []string {
-	in, err := files.Open(ctx, filename)
+	// Cancelling the context that the input was opened with aborts the remote transfer,
+	// once --max-bytes has been exceeded.
+	openCtx, abortInput := context.WithCancel(ctx)
+	defer abortInput()
+
+	in, err := openCatInput(openCtx, filename, Flags.Retries)
 	if err != nil {
-		glog.Errorf("files.Open: %v", err)
-		return nil
+		logger.Error("files.Open: ", err)
+		reportTimeout(filename, err)
+		return err
 	}
 	defer func() {
 		if err := in.Close(); err != nil {
-			glog.Error("filelist.Close: ", err)
+			logger.Error("input.Close: ", err)
 		}
 	}()
 
+	recordInputInfo(ctx, in)
+
 	printName := filename
 	switch filename {
 	case "", "-", "/dev/stdin":
 	default:
-		if printName = in.Name(); filename != printName {
-			glog.Info("filelist redirected: ", printName)
+		// Never log any credentials that withCredentials added to the name that was opened.
+		if printName = withoutUserinfo(in.Name()); withoutUserinfo(filename) != printName {
+			if !Flags.Quiet {
+				logger.Info("input redirected: ", printName)
+			}
 		}
 	}
 
@@ -166,241 +316,1695 @@ func FilelistFromFile(ctx context.Context, filename string) []string {
 	}
 
 	if glog.V(5) {
-		glog.Info("filelist: ", printName)
+		logger.Info("cat file: ", printName)
 	}
 
-	data, err := files.ReadFrom(in)
-	if err != nil {
-		glog.Error(err)
-		return nil
-	}
+	// Only seek if the content read is the same as the content of the file.
+	canSeekTail := Flags.Tail > 0 && inputRange == nil && Flags.Head == 0 && Flags.TrimBytesStart == 0 && Flags.TrimBytesEnd == 0 && Flags.Extract == "" && Flags.Frame == frameNone
 
-	lines := bytes.Split(data, []byte("\n"))
-
-	if glog.V(2) {
-		glog.Infof("%s: %d lines of files", printName, len(lines))
+	switch {
+	case !canSeekTail:
+	case Flags.Decompress == decompressAlways:
+		canSeekTail = false
+	case Flags.Decompress == decompressAuto:
+		compressed, err := isCompressed(in, in.Name())
+		if err != nil {
+			logger.Errorf("%s: %v", printName, err)
+			return err
+		}
+		canSeekTail = !compressed
 	}
 
-	var list []string
-
-	for _, line := range lines {
-		line = bytes.TrimSpace(line)
-
-		if len(line) < 1 {
-			continue
+	if canSeekTail {
+		seeked, err := seekTail(in, Flags.Tail)
+		if err != nil {
+			logger.Errorf("%s: %v", printName, err)
+			return err
 		}
 
-		list = append(list, string(line))
+		if !seeked {
+			if glog.V(5) {
+				logger.Infof("%s: cannot seek, reading all of it for --tail", printName)
+			}
+		}
 	}
 
-	return list
-}
+	var r io.Reader = in
 
-func getOutput(ctx context.Context, filename string) (io.WriteCloser, error) {
-	out, err := files.Create(ctx, filename)
-	if err != nil {
-		return nil, err
+	if inputRange != nil {
+		r, err = seekRange(in, inputRange)
+		if err != nil {
+			logger.Errorf("%s: %v", printName, err)
+			return err
+		}
 	}
 
-	switch filename {
-	case "", "-", "/dev/stdout":
-	default:
-		if printName := out.Name(); printName != filename {
-			glog.Info("output redirected: ", printName)
+	if lim := inputRateLimiter(); lim != nil {
+		r = &throttledReader{
+			Reader: r,
+			ctx:    ctx,
+			lim:    lim,
 		}
 	}
 
-	return out, nil
-}
+	// A progress line redrawn in place only makes sense on a terminal.
+	if Flags.Progress && !Flags.Quiet && isTerminal(os.Stderr) {
+		var total int64
+		if info, err := in.Stat(); err == nil {
+			total = info.Size()
+		}
 
-func main() {
-	flag.Set("logtostderr", "true")
+		// A ranged response is already only as big as the range, so only a range applied locally by seekRange is taken out of the total.
+		if inputRange != nil && total > 0 && !isRanged(in) {
+			total = max(0, total-inputRange.start)
+			if inputRange.end >= 0 {
+				total = min(total, inputRange.end-inputRange.start)
+			}
+		}
 
-	ctx, finish := process.Init("allcat", Version, Buildstamp)
-	defer finish()
+		p := newProgress(os.Stderr, printName, total)
+		p.minSize = Flags.ProgressMinSize
+		p.minDuration = Flags.ProgressMinDuration
 
-	ctx = httpfiles.WithUserAgent(ctx, Flags.UserAgent)
+		r = p.Reader(r)
 
-	switch {
-	case Flags.ShowAll: // equivalent to -vET
-		Flags.ShowEnds = true
-		Flags.ShowTabs = true
-		Flags.ShowNonprinting = true
-	case Flags.ShowAllButTabs: // equivlanet to -vE
-		Flags.ShowEnds = true
-		Flags.ShowNonprinting = true
-	case Flags.ShowAllButEnds: // equivalent to -vT
-		Flags.ShowTabs = true
-		Flags.ShowNonprinting = true
+		// Sample the rate through the same plumbing as the running bandwidth metric, while still feeding that metric.
+		rate := observers{p}
+		if bwRunningObserver != nil {
+			rate = append(rate, bwRunningObserver)
+		}
+		opts = append(opts[:len(opts):len(opts)], files.WithIntervalBandwidthMetrics(rate, 10, 1*time.Second))
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			p.Run(ctx, 200*time.Millisecond)
+		}()
+
+		defer func() {
+			cancel()
+			<-done
+		}()
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if Flags.ChunkTiming {
+		timer := newChunkTimer(r)
+		r = timer
 
-	stderr := os.Stderr
-	if Flags.Quiet {
-		stderr = nil
+		// Report even if the copy fails, as stalls are what this is meant to diagnose.
+		defer func() {
+			if Flags.Quiet {
+				return
+			}
+
+			if err := timer.writeSummary(os.Stderr, printName, Flags.ChunkTimingJSON); err != nil {
+				logger.Error("chunk timing: ", err)
+			}
+		}()
 	}
 
-	if glog.V(2) {
-		if err := flag.Set("stderrthreshold", "INFO"); err != nil {
-			glog.Error(err)
+	var capped *byteCapper
+	if Flags.MaxBytes > 0 {
+		capped = &byteCapper{
+			n:    Flags.MaxBytes,
+			done: abortInput,
 		}
 	}
 
-	if Flags.MetricsPort != 0 || Flags.MetricsAddress != "" {
-		Flags.Metrics = true
+	if Flags.Base64Decode {
+		// Decoded first, so that a base64 encoded compressed file is then decompressed as usual.
+		r = base64.NewDecoder(base64Encoding(), &spaceSkipper{
+			Reader: r,
+		})
 	}
 
-	var err error
+	if capped != nil && Flags.MaxBytesCompressed {
+		capped.Reader = r
+		r = capped
+	}
 
-	out, err := getOutput(ctx, Flags.Output)
+	filtered, err := filterInput(ctx, r, in.Name())
 	if err != nil {
-		glog.Fatal("could not open output:", err)
+		logger.Errorf("%s: %v", printName, err)
+		return err
 	}
-	defer func(out io.Closer) {
-		if err := out.Close(); err != nil {
-			glog.Error("output.Close: ", err)
+	defer func() {
+		if err := filtered.Close(); err != nil {
+			if capped != nil && capped.hit && errors.Is(err, io.ErrUnexpectedEOF) {
+				return
+			}
+			logger.Error("filter.Close: ", err)
 		}
-	}(out)
+	}()
 
-	if Flags.ShowEnds {
-		old := out
-		out = &byteReplacer{
-			WriteCloser: old,
-			sep:         '\n',
-			with:        []byte("$\n"),
+	r = filtered
+
+	if fromCharset != nil {
+		r = transform.NewReader(r, charsetDecoder(fromCharset, int(Flags.OnInvalid)))
+	}
+
+	// Each file gets its own stripper, so only the BOM at the start of each file is dropped.
+	if Flags.StripBOM {
+		r = &bomStripper{
+			Reader: r,
 		}
 	}
 
-	switch {
-	case Flags.NumberNonblank:
-		old := out
-		out = &nonblankLineNumberer{
-			WriteCloser: old,
+	// Dumping a binary file to a terminal garbles it, so it is sniffed for, after it has been decompressed and decoded.
+	if guardTerminal {
+		var isBinary bool
+
+		r, isBinary, err = sniffBinary(r)
+		if err != nil {
+			logger.Errorf("%s: %v", printName, err)
+			return err
 		}
-	case Flags.Number:
-		old := out
-		out = &lineNumberer{
-			WriteCloser: old,
+
+		if isBinary {
+			if Flags.Binary == binaryWarn {
+				logger.Warningf("%s: binary file, not output to a terminal; pass --binary=force to output it anyway", printName)
+			}
+			return nil
 		}
 	}
 
-	if Flags.SqueezeBlank {
-		old := out
-		out = &blankSqueezer{
-			WriteCloser: old,
+	if Flags.JSONPretty || Flags.JSONMinify {
+		var indent string
+		if Flags.JSONPretty {
+			indent = jsonIndent
 		}
+
+		reformatted := reformatJSON(r, indent)
+		defer reformatted.Close()
+
+		r = reformatted
 	}
 
-	if Flags.ShowNonprinting {
-		old := out
-		out = &nonprintReplacer{
-			WriteCloser: old,
+	if capped != nil && !Flags.MaxBytesCompressed {
+		capped.Reader = r
+		r = capped
+	}
+
+	if Flags.Reverse {
+		// Nothing can be emitted until the last line has been read, so the whole file is buffered in memory.
+		// Not files.ReadFrom, as that would close the filtered input, which is closed above.
+		data, err := io.ReadAll(r)
+		if err != nil {
+			logger.Errorf("%s: %v", printName, err)
+			return err
 		}
+
+		r = bytes.NewReader(reverseLines(data))
 	}
 
-	if Flags.ShowTabs {
-		old := out
-		out = &byteReplacer{
-			WriteCloser: old,
-			sep:         '\t',
-			with:        []byte("^I"),
+	if Flags.Base64Encode {
+		enc := newBase64Encoder(out)
+		defer func() {
+			if err := enc.Close(); err != nil {
+				logger.Error("base64: ", err)
+			}
+		}()
+
+		out = enc
+	}
+
+	if toCharset != nil {
+		// The encoder may hold the start of a character split across Writes, until Close.
+		tw := transform.NewWriter(out, charsetEncoder(toCharset, int(Flags.OnInvalid)))
+		defer func() {
+			if err := tw.Close(); err != nil {
+				logger.Errorf("%s: %v", printName, err)
+			}
+		}()
+
+		out = tw
+	}
+
+	// Bytes appended while following bypass --tail, --lines, and --trim-bytes-end, as tail -f does.
+	followOut := out
+
+	var tail *lineTail
+	if Flags.Tail > 0 {
+		tail = &lineTail{
+			Writer: out,
+			n:      Flags.Tail,
 		}
+
+		out = tail
 	}
 
-	var opts []files.CopyOption
+	copyCtx := ctx
 
-	bufferSize := Flags.BufferSize
+	var ranger *lineRanger
+	if inputLines != nil {
+		var cancel context.CancelFunc
+		copyCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
 
-	if Flags.PacketSize > 0 {
-		bufferSize -= bufferSize % Flags.PacketSize
-		if bufferSize <= 0 {
-			bufferSize = Flags.PacketSize
+		// Once past the end of the range, stop the copy rather than reading the rest of the input.
+		ranger = &lineRanger{
+			Writer:   out,
+			lineSpan: *inputLines,
+			done:     cancel,
 		}
+
+		out = ranger
 	}
 
-	if bufferSize := int(bufferSize); bufferSize > 0 {
-		opts = append(opts, files.WithBufferSize(bufferSize))
-		glog.V(2).Info("using copy buffer size: ", bufferSize)
+	if Flags.TrimBytesEnd > 0 {
+		trim := &tailTrimmer{
+			Writer: out,
+			n:      Flags.TrimBytesEnd,
+		}
+		defer trim.Close()
+
+		out = trim
 	}
 
-	if Flags.Metrics {
-		opts = append(opts,
-			files.WithBandwidthMetrics(bwLifetime),
-			files.WithIntervalBandwidthMetrics(bwRunning, 10, 1*time.Second),
-		)
+	start := time.Now()
 
-		go func() {
-			addr := Flags.MetricsAddress
-			if addr == "" {
-				addr = fmt.Sprintf(":%d", Flags.MetricsPort)
-			}
+	n, err := pooledCopy(copyCtx, out, r, opts...)
 
-			l, err := net.Listen("tcp4", addr)
-			if err != nil {
-				glog.Fatal("net.Listen: ", err)
-			}
-			defer l.Close()
+	if ranger != nil && ranger.past && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		err = nil
+	}
 
-			msg := fmt.Sprintf("metrics available at: http://%s/metrics", l.Addr())
-			if stderr != nil {
-				fmt.Fprintln(stderr, msg)
-			}
-			glog.Info(msg)
+	// A decompressor cut off partway through its stream by --max-bytes-compressed reports that it ended unexpectedly.
+	if capped != nil && capped.hit && errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
 
-			http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-				http.Redirect(w, req, "/metrics", http.StatusMovedPermanently)
-			})
+	if err != nil && err != io.EOF {
+		logger.Error(err)
 
-			srv := &http.Server{}
+		if n > 0 {
+			logger.Errorf("%s: %d bytes copied in %v", printName, n, time.Since(start))
+		}
 
-			go func() {
-				select {
-				case <-ctx.Done():
-					// maybe the whole copy has already completed, because it is small.
-					return
-				default:
-				}
+		reportTimeout(printName, err)
+		return err
+	}
 
-				if err := srv.Serve(l); err != nil {
-					if err != http.ErrServerClosed {
-						glog.Fatal("http.Serve: ", err)
-					}
-				}
-			}()
+	if tail != nil {
+		if err := tail.flush(); err != nil {
+			logger.Error(err)
+			return err
+		}
+	}
 
-			<-ctx.Done()
+	dur := time.Since(start)
 
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+	scheme := labelScheme.WithValue(schemeOf(filename))
 
-			if err := srv.Shutdown(ctx); err != nil {
-				glog.Error("http.Server.Shutdown: ", err)
-			}
-		}()
-	}
+	filesProcessed.WithLabels(scheme).Inc()
+	bytesCopied.Add(float64(n))
+	copySeconds.Add(dur.Seconds())
+	summary.copied(n)
 
-	filenames := flag.Args()
+	copyDuration.WithLabels(scheme).ObserveDuration(dur)
+	fileSize.WithLabels(scheme).Observe(float64(n))
 
-	if len(Flags.Files) > 0 {
-		for _, file := range Flags.Files {
-			filenames = append(filenames, FilelistFromFile(ctx, file)...)
-		}
+	if glog.V(2) {
+		logger.Infof("%s: %d bytes copied in %v", printName, n, dur)
 	}
 
-	if len(filenames) < 1 {
-		filenames = append(filenames, "-")
+	if capped != nil && capped.hit {
+		logger.Warningf("%s: truncated after --max-bytes=%d", printName, Flags.MaxBytes)
+		return errTruncated
 	}
 
-	if Flags.List {
-		for _, filename := range filenames {
-			ListFile(ctx, out, filename)
-		}
-		return
+	if Flags.Follow {
+		return followFile(ctx, followOut, filename, in, Flags.FollowInterval, opts)
 	}
 
-	for _, filename := range filenames {
-		CatFile(ctx, out, filename, opts)
+	return nil
+}
+
+// FilelistFromFile reads a list of filenames from a file, one per line.
+// Blank lines, and lines starting with # are skipped,
+// and shell-style glob patterns are expanded into the filenames they match, as expandGlob does.
+// A filename of "-" reads the list from stdin, so that `find ... | allcat --files=-` works.
+//
+// If the delimiter is NUL rather than newline, as from `find -print0`, then each filename is taken literally:
+// it is not trimmed, nor treated as a comment or glob, since any of those could be part of a real filename.
+func FilelistFromFile(ctx context.Context, filename string, delim byte) []string {
+	in, err := files.Open(ctx, filename)
+	if err != nil {
+		logger.Errorf("files.Open: %v", err)
+		return nil
+	}
+
+	printName := filename
+	switch filename {
+	case "", "-", "/dev/stdin":
+	default:
+		if printName = in.Name(); filename != printName {
+			if !Flags.Quiet {
+				logger.Info("filelist redirected: ", printName)
+			}
+		}
+	}
+
+	if len(printName) > 40 {
+		printName = printName[:40] + "…"
+	}
+
+	if glog.V(5) {
+		logger.Info("filelist: ", printName)
+	}
+
+	// files.ReadFrom also closes the input, so it must not be closed again, or stdin reports that it is already closed.
+	data, err := files.ReadFrom(in)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	lines := bytes.Split(data, []byte{delim})
+
+	if glog.V(2) {
+		logger.Infof("%s: %d lines of files", printName, len(lines))
+	}
+
+	var list []string
+
+	if delim == 0 {
+		for _, line := range lines {
+			if len(line) > 0 {
+				list = append(list, string(line))
+			}
+		}
+
+		return list
+	}
+
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+
+		if len(line) < 1 || line[0] == '#' {
+			continue
+		}
+
+		list = append(list, string(line))
+	}
+
+	return expandGlobs(ctx, list)
+}
+
+// parseOutputMode returns the permissions of --output-mode, which must be set.
+func parseOutputMode() (os.FileMode, error) {
+	m, err := strconv.ParseUint(Flags.OutputMode, 8, 32)
+	if err != nil || m&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("bad --output-mode %q: expected octal permissions, like 0600", Flags.OutputMode)
+	}
+
+	return os.FileMode(m), nil
+}
+
+func getOutput(ctx context.Context, filename string) (io.WriteCloser, error) {
+	var mode os.FileMode
+	if Flags.OutputMode != "" {
+		m, err := parseOutputMode()
+		if err != nil {
+			return nil, err
+		}
+		mode = m
+	}
+
+	var out files.Writer
+	var err error
+
+	switch filename {
+	case "", "-", "/dev/stdout":
+		out, err = files.Create(ctx, filename)
+
+		if f, ok := out.(*os.File); ok && Flags.SummaryStdout {
+			out = &stdoutKeptOpen{
+				File: f,
+			}
+		}
+	default:
+		// Opening a FIFO for writing blocks until it has a reader, so this must respect the context, and --open-timeout.
+		out, err = openAsync(ctx, func() (files.Writer, error) {
+			if Flags.Append {
+				return openAppend(ctx, filename)
+			}
+
+			if Flags.Atomic {
+				return newAtomicOutput(ctx, filename)
+			}
+
+			return files.Create(ctx, filename)
+		}, Flags.OpenTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch filename {
+	case "", "-", "/dev/stdout":
+	default:
+		if printName := out.Name(); printName != filename {
+			if !Flags.Quiet {
+				logger.Info("output redirected: ", printName)
+			}
+		}
+
+		if Flags.OutputMode == "" {
+			break
+		}
+
+		if _, err := files.WithFileMode(mode)(out); err != nil {
+			if errors.Is(err, files.ErrNotSupported) {
+				logger.Warningf("%s: --output-mode not supported: %v", out.Name(), err)
+				break
+			}
+
+			out.Close()
+			return nil, err
+		}
+	}
+
+	switch schemeOf(filename) {
+	case "http", "https", "s3":
+		if Flags.LineBuffered {
+			logger.Warningf("%s: --line-buffered has no effect, as the whole output is sent at once", out.Name())
+		}
+
+		// These backends buffer the whole output, and send it on Close with a known Content-Length,
+		// so strict endpoints never see a chunked transfer, even when the input size is unknown.
+		return &announcedOutput{
+			WriteCloser: out,
+			name:        out.Name(),
+		}, nil
+	}
+
+	// A local file is written straight through, so it needs no flushing, and a Sync of it would be an fsync.
+	isFile := false
+	switch out.(type) {
+	case *os.File, *stdoutKeptOpen:
+		isFile = true
+	}
+
+	if Flags.LineBuffered && !isFile {
+		return &lineFlusher{
+			Writer: out,
+		}, nil
+	}
+
+	return out, nil
+}
+
+// announcedOutput counts the bytes written to a buffered output, to report the Content-Length it is sent with.
+type announcedOutput struct {
+	io.WriteCloser
+	name string
+	n    int64
+}
+
+func (w *announcedOutput) Write(b []byte) (n int, err error) {
+	n, err = w.WriteCloser.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *announcedOutput) Close() error {
+	if glog.V(2) {
+		logger.Infof("%s: sending with Content-Length: %d", w.name, w.n)
+	}
+
+	return w.WriteCloser.Close()
+}
+
+// CatHashedFile prints the given filename out to a content-addressed file in the given directory.
+func CatHashedFile(ctx context.Context, dir, filename string, opts []files.CopyOption) error {
+	var mode os.FileMode
+	if Flags.OutputMode != "" {
+		m, err := parseOutputMode()
+		if err != nil {
+			logger.Error("could not open output: ", err)
+			return err
+		}
+		mode = m
+	}
+
+	hashed, err := newHashedOutput(ctx, dir, Flags.OutputHashAlgorithm, Flags.OutputHashPrefix, Flags.OutputHashSuffix, mode, Flags.OutputMode != "")
+	if err != nil {
+		logger.Error("could not open output: ", err)
+		return err
+	}
+
+	enc, err := encodeOutput(hashed)
+	if err != nil {
+		logger.Error("could not open output: ", err)
+
+		hashed.discard = true
+		hashed.Close()
+		return err
+	}
+
+	out := wrapOutput(enc)
+
+	var info *inputInfo
+	if Flags.Preserve {
+		ctx, info = withInputInfo(ctx)
+	}
+
+	if err := CatFile(ctx, out, filename, opts); err != nil {
+		// do not leave behind a partial or empty file.
+		hashed.discard = true
+
+		if err := out.Close(); err != nil {
+			logger.Error("output.Close: ", err)
+		}
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		logger.Error("output.Close: ", err)
+		summary.failed(filename, err)
+		return err
+	}
+
+	if Flags.Preserve {
+		preserveModTime(nil, hashed.Name(), info)
+	}
+
+	if glog.V(2) {
+		logger.Infof("%s: written to %s", filename, hashed.Name())
+	}
+
+	return nil
+}
+
+// copyBufferSize returns the copy buffer size to use, per the flags, or zero for the default.
+func copyBufferSize() int {
+	bufferSize := Flags.BufferSize
+
+	if Flags.PacketSize > 0 {
+		bufferSize -= bufferSize % Flags.PacketSize
+		if bufferSize <= 0 {
+			bufferSize = Flags.PacketSize
+		}
+	}
+
+	return int(bufferSize)
+}
+
+// runeTranslation is the translation given by --translate and --delete, if any.
+var runeTranslation *translation
+
+// indexPattern is the pattern given by --index, if any.
+var indexPattern *regexp.Regexp
+
+// matchPattern is the pattern given by --match, if any.
+var matchPattern *regexp.Regexp
+
+// excludePattern is the pattern given by --no-match, if any.
+var excludePattern *regexp.Regexp
+
+// inputRange is the byte range given by --bytes, if any.
+var inputRange *byteRange
+
+// inputLines is the line range given by --lines, if any.
+var inputLines *lineSpan
+
+// lineSample is the sample rate given by --sample-lines, if any.
+var lineSample *sampleRate
+
+// wrapOutput wraps the given output with each of the mutators enabled by the flags.
+func wrapOutput(out io.WriteCloser) io.WriteCloser {
+	bottom := newCoalescedOutput(out)
+	out = bottom
+
+	numbering := []mutate.NumberOption{
+		mutate.WithNumberFormat(numberFormat),
+		mutate.WithStartNumber(Flags.StartNumber),
+	}
+
+	switch {
+	case Flags.FusedLines && !Flags.NumberOnChange && (Flags.ShowEnds || Flags.Number || Flags.NumberNonblank || Flags.SqueezeBlank):
+		out = mutate.NewFusedLineWriter(out, mutate.FusedConfig{
+			SqueezeBlank:   Flags.SqueezeBlank,
+			Number:         Flags.Number,
+			NumberNonblank: Flags.NumberNonblank,
+			ShowEnds:       Flags.ShowEnds,
+		}, numbering...)
+
+	default:
+		if Flags.ShowEnds {
+			out = mutate.NewLineEndMarker(out)
+		}
+
+		switch {
+		case Flags.NumberOnChange:
+			out = mutate.NewChangeNumberer(out, Flags.NumberNonblank, numbering...)
+		case Flags.NumberNonblank:
+			out = mutate.NewNonblankLineNumberer(out, numbering...)
+		case Flags.Number:
+			out = mutate.NewLineNumberer(out, numbering...)
+		}
+
+		if Flags.SqueezeBlank {
+			out = mutate.NewBlankSqueezer(out)
+		}
+	}
+
+	// Lines are truncated before they are numbered, or marked with $, so -n and -E are always added to what is kept,
+	// but after -v, so that it is the displayed characters that are counted.
+	if Flags.LineLimit > 0 {
+		out = mutate.NewLineTruncator(out, Flags.LineLimit, []byte(Flags.LineLimitMarker))
+	}
+
+	switch {
+	case Flags.Hex:
+		// A hexdump already displays every byte, so it takes the place of -v.
+		out = mutate.NewHexDumper(out, Flags.HexCols)
+
+	case Flags.ShowNonprinting:
+		out = mutate.NewNonprintReplacer(out, Flags.UTF8)
+	}
+
+	if Flags.ShowTabs {
+		out = mutate.NewByteReplacer(out, '\t', []byte("^I"))
+	}
+
+	switch {
+	case Flags.ExpandTabs > 0:
+		out = mutate.NewTabExpander(out, Flags.ExpandTabs)
+
+	case Flags.UnexpandTabs > 0:
+		out = mutate.NewTabUnexpander(out, Flags.UnexpandTabs)
+	}
+
+	// -v already displays CR as ^M, so this is only needed without it.
+	if Flags.ShowCR && !Flags.ShowNonprinting {
+		out = mutate.NewByteReplacer(out, '\r', []byte("^M"))
+	}
+
+	if Flags.LineEnding != lineEndingKeep {
+		out = mutate.NewLineEndingNormalizer(out, Flags.LineEnding == lineEndingCRLF)
+	}
+
+	if lineSample != nil {
+		out = newLineSampler(out, lineSample, Flags.SampleSeed)
+	}
+
+	if Flags.Uniq || Flags.UniqCount {
+		out = mutate.NewLineUniq(out, Flags.UniqCount)
+	}
+
+	if matchPattern != nil || excludePattern != nil {
+		old := out
+		out = &lineMatcher{
+			WriteCloser: old,
+			re:          matchPattern,
+			exclude:     excludePattern,
+			before:      Flags.GrepBefore,
+			after:       Flags.GrepAfter,
+		}
+	}
+
+	if runeTranslation != nil {
+		old := out
+		out = &runeTranslator{
+			WriteCloser: old,
+			t:           runeTranslation,
+		}
+	}
+
+	if indexPattern != nil {
+		// Without --index-only, the index is kept out of the content, on stderr.
+		var index io.Writer = out
+		if !Flags.IndexOnly {
+			index = os.Stderr
+		}
+
+		if Flags.IndexOnly || !Flags.Quiet {
+			old := out
+			out = &lineIndexer{
+				WriteCloser: old,
+				index:       index,
+				indexOnly:   Flags.IndexOnly,
+				re:          indexPattern,
+			}
+		}
+	}
+
+	if out == io.WriteCloser(bottom) {
+		// no mutators are enabled, so there are no small Writes to coalesce.
+		return bottom.out
+	}
+
+	return &flushedChain{
+		WriteCloser: out,
+		bottom:      bottom,
+	}
+}
+
+func main() {
+	flag.Set("logtostderr", "true")
+
+	// This is deferred first, so that it runs last: os.Exit does not run deferred functions.
+	defer func() {
+		if exitStatus != 0 {
+			os.Exit(exitStatus)
+		}
+	}()
+
+	ctx, finish := process.Init("allcat", Version, Buildstamp)
+	defer finish()
+
+	if Flags.LogFormat == logFormatJSON {
+		logger = newJSONSink(os.Stderr)
+	}
+
+	if Flags.Quiet && Flags.Verbose > 0 {
+		logger.Fatal("--quiet and --verbose are mutually exclusive")
+	}
+
+	if err := applyVerbosity(Flags.Verbose); err != nil {
+		logger.Fatal("bad --verbose: ", err)
+	}
+
+	if Flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, Flags.Timeout)
+		defer cancel()
+	}
+
+	ctx = httpfiles.WithUserAgent(ctx, Flags.UserAgent)
+
+	if Flags.CABundle != "" || Flags.InsecureSkipVerify {
+		conf, err := newTLSConfig(Flags.CABundle, Flags.InsecureSkipVerify)
+		if err != nil {
+			logger.Fatal("bad --ca-bundle: ", err)
+		}
+
+		if Flags.InsecureSkipVerify {
+			logger.Warning("TLS certificate verification is disabled for all https requests, per --insecure-skip-verify")
+		}
+
+		ctx = withTLSConfig(ctx, conf)
+	}
+
+	// Even with no other layer, http requests go through withTransport, so that a transient error status is a statusError.
+	ctx = withTransport(ctx, transportFrom(ctx))
+
+	if Flags.Credentials != "" {
+		n, err := loadNetrc(Flags.Credentials)
+		if err != nil {
+			logger.Fatal("bad --credentials: ", err)
+		}
+		credentials = n
+
+	} else if filename, err := defaultNetrc(); err == nil {
+		n, err := loadNetrc(filename)
+		switch {
+		case err == nil:
+			credentials = n
+		case !errors.Is(err, os.ErrNotExist):
+			logger.Warning("ignoring credentials: ", err)
+		}
+	}
+
+	if Flags.User != "" && Flags.Bearer != "" {
+		logger.Fatal("--user and --bearer are mutually exclusive")
+	}
+
+	if Flags.Bearer != "" {
+		value := "Bearer " + Flags.Bearer
+
+		ctx = withAuthorization(ctx, func() (string, error) {
+			return value, nil
+		})
+	}
+
+	if Flags.User != "" {
+		ctx = withAuthorization(ctx, basicAuth(Flags.User))
+	}
+
+	if len(Flags.Header) > 0 {
+		header, err := parseHeaders(Flags.Header)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		ctx = withHeaders(ctx, header)
+	}
+
+	switch {
+	case Flags.ShowAll: // equivalent to -vET
+		Flags.ShowEnds = true
+		Flags.ShowTabs = true
+		Flags.ShowNonprinting = true
+	case Flags.ShowAllButTabs: // equivlanet to -vE
+		Flags.ShowEnds = true
+		Flags.ShowNonprinting = true
+	case Flags.ShowAllButEnds: // equivalent to -vT
+		Flags.ShowTabs = true
+		Flags.ShowNonprinting = true
+	}
+
+	switch {
+	case Flags.Dos2Unix && Flags.Unix2Dos:
+		logger.Fatal("--dos2unix and --unix2dos are mutually exclusive")
+	case Flags.Dos2Unix:
+		Flags.LineEnding = lineEndingLF
+	case Flags.Unix2Dos:
+		Flags.LineEnding = lineEndingCRLF
+	}
+
+	if Flags.Base64Encode && Flags.Base64Decode {
+		logger.Fatal("--base64-encode and --base64-decode are mutually exclusive")
+	}
+
+	if Flags.FromCharset != "" {
+		enc, err := lookupCharset(Flags.FromCharset)
+		if err != nil {
+			logger.Fatal("bad --from-charset: ", err)
+		}
+
+		if enc != unicode.UTF8 {
+			fromCharset = enc
+		}
+	}
+
+	if Flags.ToCharset != "" {
+		enc, err := lookupCharset(Flags.ToCharset)
+		if err != nil {
+			logger.Fatal("bad --to-charset: ", err)
+		}
+
+		if enc != unicode.UTF8 {
+			toCharset = enc
+		}
+	}
+
+	if Flags.MinSize != "" || Flags.MaxSize != "" || Flags.NewerThan != "" || Flags.OlderThan != "" {
+		b := &listBounds{
+			minSize: -1,
+			maxSize: -1,
+		}
+
+		var err error
+		now := time.Now()
+
+		if Flags.MinSize != "" {
+			if b.minSize, err = parseHumanSize(Flags.MinSize); err != nil {
+				logger.Fatal("bad --min-size: ", err)
+			}
+		}
+
+		if Flags.MaxSize != "" {
+			if b.maxSize, err = parseHumanSize(Flags.MaxSize); err != nil {
+				logger.Fatal("bad --max-size: ", err)
+			}
+		}
+
+		if Flags.NewerThan != "" {
+			if b.newerThan, err = parseListTime(Flags.NewerThan, now); err != nil {
+				logger.Fatal("bad --newer-than: ", err)
+			}
+		}
+
+		if Flags.OlderThan != "" {
+			if b.olderThan, err = parseListTime(Flags.OlderThan, now); err != nil {
+				logger.Fatal("bad --older-than: ", err)
+			}
+		}
+
+		listLimits = b
+	}
+
+	for _, patterns := range [][]string{Flags.Name, Flags.IName, Flags.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				logger.Fatalf("bad --list pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	if Flags.JSONPretty && Flags.JSONMinify {
+		logger.Fatal("--json-pretty and --json-minify are mutually exclusive")
+	}
+
+	if Flags.RateLimit != "" {
+		rate, err := parseRate(Flags.RateLimit)
+		if err != nil || rate < 1 {
+			logger.Fatalf("bad --rate-limit %q: expected bytes per second, like 500K/s", Flags.RateLimit)
+		}
+		inputRate = rate
+
+		if Flags.RateLimitScope == rateLimitTotal {
+			totalRateLimiter = newRateLimiter(rate)
+		}
+	}
+
+	if Flags.Atomic && (Flags.Append || Flags.Resume) {
+		logger.Fatal("--atomic cannot be used with --append, or --resume")
+	}
+
+	if Flags.Prefetch && Flags.Jobs > 1 {
+		logger.Fatal("--prefetch and --jobs are mutually exclusive")
+	}
+
+	if Flags.LineLimit < 0 {
+		logger.Fatal("--line-limit cannot be negative")
+	}
+
+	if Flags.HexCols < 1 {
+		logger.Fatal("--hex-cols must be at least 1")
+	}
+
+	if Flags.ExpandTabs < 0 || Flags.UnexpandTabs < 0 {
+		logger.Fatal("--expand-tabs and --unexpand-tabs cannot be negative")
+	}
+
+	if Flags.ExpandTabs > 0 && Flags.UnexpandTabs > 0 {
+		logger.Fatal("--expand-tabs and --unexpand-tabs are mutually exclusive")
+	}
+
+	if Flags.Head < 0 || Flags.Tail < 0 {
+		logger.Fatal("--head and --tail cannot be negative")
+	}
+
+	if Flags.TrimBytesStart < 0 || Flags.TrimBytesEnd < 0 {
+		logger.Fatal("--trim-bytes-start and --trim-bytes-end cannot be negative")
+	}
+
+	if Flags.NumberWidth != 6 || Flags.NumberPad != numberPadSpace || Flags.NumberSeparator != `\t` {
+		if Flags.NumberFormat != `%6d\t` {
+			logger.Fatal("--number-format cannot be combined with --number-width, --number-pad, or --number-separator")
+		}
+
+		if Flags.NumberWidth < 0 {
+			logger.Fatal("--number-width cannot be negative")
+		}
+
+		sep, err := strconv.Unquote(`"` + Flags.NumberSeparator + `"`)
+		if err != nil {
+			logger.Fatalf("bad --number-separator %q: %v", Flags.NumberSeparator, err)
+		}
+
+		var pad string
+		if Flags.NumberPad == numberPadZero {
+			pad = "0"
+		}
+
+		// The separator is escaped, so that a % in it is not taken as another verb.
+		numberFormat = fmt.Sprintf("%%%s%dd%s", pad, Flags.NumberWidth, strings.ReplaceAll(sep, "%", "%%"))
+	}
+
+	if Flags.NumberFormat != `%6d\t` {
+		format, err := strconv.Unquote(`"` + Flags.NumberFormat + `"`)
+		if err != nil {
+			logger.Fatalf("bad --number-format %q: %v", Flags.NumberFormat, err)
+		}
+
+		if err := mutate.CheckNumberFormat(format); err != nil {
+			logger.Fatal(err)
+		}
+		numberFormat = format
+	}
+
+	if Flags.Frame != frameNone {
+		sep, err := parseFrameSeparator(Flags.FrameSeparator)
+		if err != nil {
+			logger.Fatalf("bad --frame-separator %q: %v", Flags.FrameSeparator, err)
+		}
+		frameSeparator = []byte(sep)
+	}
+
+	if Flags.Bytes != "" {
+		br, err := parseByteRange(Flags.Bytes)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		inputRange = br
+	}
+
+	if Flags.Lines != "" {
+		span, err := parseLineSpan(Flags.Lines)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		inputLines = span
+	}
+
+	if Flags.SampleLines != "" {
+		rate, err := parseSampleRate(Flags.SampleLines)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		lineSample = rate
+
+		if rate.every < 1 && Flags.SampleSeed == 0 {
+			Flags.SampleSeed = time.Now().UnixNano()
+			if glog.V(2) {
+				logger.Info("using sample seed: ", Flags.SampleSeed)
+			}
+		}
+	}
+
+	if Flags.Translate != "" || Flags.Delete != "" {
+		t, err := newTranslation(Flags.Translate, Flags.Delete)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		runeTranslation = t
+	}
+
+	if Flags.GrepContext < 0 || Flags.GrepBefore < 0 || Flags.GrepAfter < 0 {
+		logger.Fatal("--context, --before-context, and --after-context cannot be negative")
+	}
+
+	if Flags.GrepContext > 0 {
+		if Flags.GrepBefore == 0 {
+			Flags.GrepBefore = Flags.GrepContext
+		}
+		if Flags.GrepAfter == 0 {
+			Flags.GrepAfter = Flags.GrepContext
+		}
+	}
+
+	if Flags.Match != "" {
+		re, err := regexp.Compile(Flags.Match)
+		if err != nil {
+			logger.Fatalf("bad --match pattern: %v", err)
+		}
+		matchPattern = re
+	}
+
+	if Flags.NoMatch != "" {
+		re, err := regexp.Compile(Flags.NoMatch)
+		if err != nil {
+			logger.Fatalf("bad --no-match pattern: %v", err)
+		}
+		excludePattern = re
+	}
+
+	if Flags.Index != "" {
+		re, err := regexp.Compile(Flags.Index)
+		if err != nil {
+			logger.Fatalf("bad --index pattern: %v", err)
+		}
+		indexPattern = re
+	} else if Flags.IndexOnly {
+		logger.Fatal("--index-only requires an --index pattern")
+	}
+
+	var verify *digest
+	if Flags.VerifyChecksum != "" {
+		d, err := parseDigest(Flags.VerifyChecksum)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		verify = d
+	}
+
+	var resumeVerify *digest
+	if Flags.ResumeChecksum != "" {
+		if !Flags.Resume {
+			logger.Fatal("--resume-checksum requires --resume")
+		}
+
+		d, err := parseDigest(Flags.ResumeChecksum)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		resumeVerify = d
+	}
+
+	if !strings.HasPrefix(Flags.MetricsRoot, "/") {
+		Flags.MetricsRoot = "/" + Flags.MetricsRoot
+	}
+
+	if Flags.ShellVar != "" && !validShellVar.MatchString(Flags.ShellVar) {
+		logger.Fatalf("invalid shell variable name: %q", Flags.ShellVar)
+	}
+
+	if Flags.Checksum != "" {
+		if _, ok := hashes[Flags.Checksum]; !ok {
+			logger.Fatalf("unknown checksum algorithm: %q", Flags.Checksum)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stderr := os.Stderr
+	if Flags.Quiet {
+		stderr = nil
+	}
+
+	if glog.V(2) {
+		if err := flag.Set("stderrthreshold", "INFO"); err != nil {
+			logger.Error(err)
+		}
+	}
+
+	if Flags.MetricsPort != 0 || Flags.MetricsAddress != "" {
+		Flags.Metrics = true
+	}
+
+	var opts []files.CopyOption
+
+	if Flags.StallTimeout > 0 {
+		opts = append(opts, files.WithWatchdogTimeout(Flags.StallTimeout))
+	}
+
+	if bufferSize := copyBufferSize(); bufferSize > 0 {
+		if glog.V(2) {
+			logger.Info("using copy buffer size: ", bufferSize)
+		}
+	}
+
+	if Flags.Metrics || Flags.MetricsSummary {
+		bwRunningObserver = &peakObserver{
+			Observer: bwRunning,
+			peak:     bwPeak,
+		}
+
+		opts = append(opts,
+			files.WithBandwidthMetrics(bwLifetime),
+			files.WithIntervalBandwidthMetrics(bwRunningObserver, 10, 1*time.Second),
+		)
+	}
+
+	if Flags.Summary && (stderr != nil || Flags.SummaryStdout) {
+		summary = newRunSummary()
+
+		w := io.Writer(stderr)
+		if Flags.SummaryStdout {
+			w = os.Stdout
+		}
+
+		defer func() {
+			if err := summary.write(w, Flags.LogFormat == logFormatJSON); err != nil {
+				logger.Error("summary: ", err)
+			}
+		}()
+	}
+
+	if Flags.MetricsSummary && stderr != nil {
+		defer func() {
+			if err := writeMetricsSummary(stderr); err != nil {
+				logger.Error("metrics summary: ", err)
+			}
+		}()
+	}
+
+	var metricsListener net.Listener
+	if Flags.Metrics {
+		addr := Flags.MetricsAddress
+		if addr == "" {
+			addr = fmt.Sprintf(":%d", Flags.MetricsPort)
+		}
+
+		l, err := listenMetrics(addr)
+		switch {
+		case err == nil:
+			metricsListener = l
+
+			// Closing a unix socket listener also removes its socket file, so this must happen even if the server never shuts down.
+			defer l.Close()
+
+		case Flags.MetricsRequired:
+			logger.Fatal("net.Listen: ", err)
+
+		default:
+			// Metrics are only a window into the copy, so do not abort the copy just because they are unavailable.
+			logger.Warning("net.Listen: ", err, "; continuing without metrics")
+			Flags.Metrics = false
+		}
+	}
+
+	if l := metricsListener; l != nil {
+		go func() {
+			msg := "metrics available at: " + metricsURL(l.Addr(), Flags.MetricsRoot)
+			if stderr != nil {
+				// Only lines of JSON should go to stderr with --log-format=json.
+				if Flags.LogFormat != logFormatJSON {
+					fmt.Fprintln(stderr, msg)
+				}
+				logger.Info(msg)
+			}
+
+			srv := &http.Server{
+				Handler: newMetricsMux(Flags.MetricsRoot, !Flags.MetricsNoRedirect),
+			}
+
+			go func() {
+				select {
+				case <-ctx.Done():
+					// maybe the whole copy has already completed, because it is small.
+					return
+				default:
+				}
+
+				if err := srv.Serve(l); err != nil {
+					// The listener is closed out from under the server, if allcat finishes before it is shut down.
+					if err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+						if Flags.MetricsRequired {
+							logger.Fatal("http.Serve: ", err)
+						}
+
+						logger.Warning("http.Serve: ", err, "; continuing without metrics")
+					}
+				}
+			}()
+
+			<-ctx.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Error("http.Server.Shutdown: ", err)
+			}
+		}()
+	}
+
+	filenames := flag.Args()
+
+	// If the file list was read from stdin, then stdin has already been consumed, and cannot be the default input.
+	var listFromStdin bool
+
+	if len(Flags.Files) > 0 {
+		delim := byte('\n')
+		if Flags.Null {
+			delim = 0
+		}
+
+		for _, file := range Flags.Files {
+			switch file {
+			case "-", "/dev/stdin":
+				if listFromStdin {
+					logger.Warning("file list already read from stdin, ignoring: ", file)
+					continue
+				}
+				listFromStdin = true
+			}
+
+			filenames = append(filenames, FilelistFromFile(ctx, file, delim)...)
+		}
+	}
+
+	if len(filenames) < 1 && !listFromStdin {
+		filenames = append(filenames, "-")
+	}
+
+	if Flags.User != "" {
+		user, _, _ := strings.Cut(Flags.User, ":")
+
+		for i, filename := range filenames {
+			filenames[i] = withSSHUser(filename, user)
+		}
+
+		Flags.Output = withSSHUser(Flags.Output, user)
+	}
+
+	if Flags.Shuffle {
+		rand.Shuffle(len(filenames), func(i, j int) {
+			filenames[i], filenames[j] = filenames[j], filenames[i]
+		})
+	}
+
+	if Flags.MaxFiles > 0 && len(filenames) > Flags.MaxFiles {
+		if glog.V(2) {
+			logger.Infof("skipping %d inputs over --max-files=%d", len(filenames)-Flags.MaxFiles, Flags.MaxFiles)
+		}
+
+		filenames = filenames[:Flags.MaxFiles]
+	}
+
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	// dst is the output, as opened, before anything wraps it.
+	var dst io.WriteCloser
+
+	// failed reports whether to stop processing the remaining inputs after the given error, per --fail-fast.
+	// If so, the context is cancelled, so that anything still in flight stops as well.
+	// Any error, but a deliberate truncation, means that an --atomic output is incomplete, and must not replace its target.
+	failed := func(err error) bool {
+		if err != nil && err != errTruncated && dst != nil {
+			discardOutput(dst)
+		}
+
+		// A file truncated by --max-bytes was still copied, as far as it was asked to be, so it is not a failure to stop at.
+		if err == nil || err == errTruncated || !Flags.FailFast {
+			return false
+		}
+
+		logger.Error("stopping at the first error, per --fail-fast")
+		abort()
+		return true
+	}
+
+	if Flags.OutputHashed {
+		if Flags.Output == "" {
+			logger.Fatal("--output-hashed requires an --output directory")
+		}
+
+		if len(Flags.Tee) > 0 {
+			logger.Fatal("--output-hashed and --tee are mutually exclusive")
+		}
+
+		for _, filename := range filenames {
+			if failed(CatHashedFile(ctx, Flags.Output, filename, opts)) {
+				break
+			}
+		}
+		return
+	}
+
+	if Flags.OutputTemplate != "" {
+		if len(Flags.Tee) > 0 {
+			logger.Fatal("--output-template and --tee are mutually exclusive")
+		}
+
+		t, err := newOutputTemplate(Flags.OutputTemplate)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		names, err := t.renderAll(filenames)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		for i, filename := range filenames {
+			if failed(CatTemplatedFile(ctx, names[i], filename, opts)) {
+				break
+			}
+		}
+		return
+	}
+
+	var resumeComplete bool
+	if Flags.Resume {
+		switch {
+		case len(filenames) != 1:
+			logger.Fatal("--resume requires exactly one input")
+		case inputRange != nil:
+			logger.Fatal("--resume and --bytes are mutually exclusive")
+		case Flags.Compress != compressOutputNone:
+			logger.Fatal("--resume and --compress are mutually exclusive")
+		}
+
+		offset, err := resumeOffset(ctx, Flags.Output, filenames[0])
+		switch {
+		case errors.Is(err, errResumeComplete):
+			if !Flags.Quiet {
+				logger.Infof("%s: already holds all %d bytes of %s, nothing to resume", Flags.Output, offset, filenames[0])
+			}
+			resumeComplete = true
+		case err != nil:
+			logger.Fatal(err)
+		case offset > 0:
+			if glog.V(2) {
+				logger.Infof("%s: resuming from byte %d of %s", Flags.Output, offset, filenames[0])
+			}
+
+			inputRange = &byteRange{
+				start: offset,
+				end:   -1,
+			}
+		}
+
+		// A gzip input is resumed as the raw bytes that it is, not as what it decompresses to.
+		if Flags.Decompress == decompressAuto {
+			Flags.Decompress = decompressNever
+		}
+
+		Flags.Append = true
+	}
+
+	out, err := getOutput(ctx, Flags.Output)
+	if err != nil {
+		logger.Fatal("could not open output:", err)
+	}
+
+	dst = out
+
+	switch {
+	case Flags.Binary == binaryForce:
+	case Flags.Output != "" && Flags.Output != "-" && Flags.Output != "/dev/stdout":
+	case Flags.ShowNonprinting || Flags.Hex || Flags.Base64Encode || Flags.Compress != compressOutputNone:
+		// These already make any binary input safe for a terminal, or are asked to be binary.
+	case Flags.ByteStats || Flags.Count || Flags.ShellVar != "":
+		// These never output the content of the inputs as is.
+	default:
+		guardTerminal = isTerminal(os.Stdout)
+	}
+
+	// verifyResumed is set once a --resume has completed, for the output to be verified with --resume-checksum once it is closed.
+	var verifyResumed bool
+
+	// Only a single input has a modification time for the whole output to take on.
+	var preserved *inputInfo
+	if Flags.Preserve {
+		switch {
+		case Flags.Output == "" || Flags.Output == "-" || Flags.Output == "/dev/stdout":
+		case len(filenames) != 1:
+			logger.Warning("--preserve with --output requires exactly one input, not preserving the modification time")
+		default:
+			ctx, preserved = withInputInfo(ctx)
+		}
+	}
+
+	if len(Flags.Tee) > 0 {
+		tee, err := newTeeOutput(ctx, out, Flags.Tee)
+		if err != nil {
+			out.Close()
+			logger.Fatal("could not open tee output: ", err)
+		}
+
+		out = tee
+	}
+
+	// Compression is applied last, after every text mutator, so that it compresses exactly what would otherwise be output.
+	// It wraps any --tee outputs as well, so that they all receive the same compressed stream.
+	if Flags.Compress == compressOutputGzip {
+		zw, err := newCompressedOutput(out, Flags.CompressLevel)
+		if err != nil {
+			out.Close()
+			logger.Fatal("bad --compress-level: ", err)
+		}
+
+		out = zw
+	}
+	defer func() {
+		// Close whatever out ends up being, so that every mutator in the chain can flush any held state.
+		if err := out.Close(); err != nil {
+			logger.Error("output.Close: ", err)
+			return
+		}
+
+		if preserved != nil {
+			preserveModTime(dst, Flags.Output, preserved)
+		}
+
+		// Only once the output is closed has all of it been written out to be verified.
+		if verifyResumed {
+			if err := verifyOutput(ctx, Flags.Output, resumeVerify); err != nil {
+				logger.Error(err)
+				exitStatus = 1
+			}
+		}
+	}()
+
+	if Flags.AddBOM {
+		if _, err := out.Write(utf8BOM); err != nil {
+			logger.Error("add-bom: ", err)
+		}
+	}
+
+	base := out
+	out = wrapOutput(out)
+
+	// The offset resumed from is a count of output bytes, so it is only an offset into the input if the output is a plain copy of it.
+	if Flags.Resume && !isPlainCopy(out, base) {
+		logger.Fatal("--resume requires a plain copy of the input, without any filters or mutators")
+	}
+
+	if Flags.List {
+		for _, filename := range filenames {
+			if failed(ListFile(ctx, out, filename)) {
+				break
+			}
+		}
+		return
+	}
+
+	if Flags.Resolve {
+		for _, filename := range filenames {
+			if failed(ResolveFile(ctx, out, filename)) {
+				break
+			}
+		}
+		return
+	}
+
+	if Flags.TarOutput {
+		tw := newTarWriter(ctx, base, opts)
+
+		for _, filename := range filenames {
+			if err := tw.Add(filename, archiveName(filename)); err != nil {
+				logger.Errorf("%s: %v", filename, err)
+
+				if failed(err) {
+					break
+				}
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			logger.Error("tar: ", err)
+		}
+		return
+	}
+
+	if Flags.ShellVar != "" {
+		for i, filename := range filenames {
+			name := shellVarName(Flags.ShellVar, i, len(filenames))
+
+			if err := CatShellVar(ctx, base, name, filename, opts); err != nil {
+				logger.Errorf("%s: %v", name, err)
+
+				if failed(err) {
+					break
+				}
+			}
+		}
+		return
+	}
+
+	if Flags.WatchDir {
+		WatchDirs(ctx, out, filenames, Flags.WatchInterval, Flags.WatchGrowing, opts)
+		return
+	}
+
+	if Flags.ByteStats {
+		stats := new(byteStats)
+
+		for _, filename := range filenames {
+			if failed(CatFile(ctx, stats, filename, opts)) {
+				break
+			}
+		}
+
+		if err := stats.writeTable(out, Flags.ByteStatsJSON); err != nil {
+			logger.Error("byte-stats: ", err)
+		}
+		return
+	}
+
+	if Flags.Count {
+		total := new(wordCounter)
+
+		// The width of the columns is not known until every input has been counted, so the lines are all written at the end.
+		var names []string
+		var counted []*wordCounter
+
+		for _, filename := range filenames {
+			counts := new(wordCounter)
+
+			err := CatFile(ctx, counts, filename, opts)
+			if failed(err) {
+				break
+			}
+			if err != nil {
+				continue
+			}
+
+			total.add(counts)
+
+			names = append(names, filename)
+			counted = append(counted, counts)
+		}
+
+		width := countWidth(total)
+
+		for i, counts := range counted {
+			if err := counts.writeCounts(out, names[i], width); err != nil {
+				logger.Error("count: ", err)
+				return
+			}
+		}
+
+		if len(filenames) > 1 {
+			if err := total.writeCounts(out, "total", width); err != nil {
+				logger.Error("count: ", err)
+			}
+		}
+		return
+	}
+
+	if Flags.Checksum != "" && Flags.ChecksumCat {
+		for _, filename := range filenames {
+			if err := CatChecksumFile(ctx, out, os.Stderr, filename, Flags.Checksum, opts); err != nil {
+				logger.Errorf("%s: %v", filename, err)
+
+				if failed(err) {
+					break
+				}
+			}
+		}
+		return
+	}
+
+	if Flags.Checksum != "" {
+		ChecksumManifest(ctx, out, filenames, Flags.Checksum, Flags.Parallel, opts)
+		return
+	}
+
+	if verify != nil {
+		if len(filenames) != 1 {
+			logger.Fatal("--verify-checksum requires exactly one input")
+		}
+
+		if err := VerifyCatFile(ctx, out, filenames[0], verify, Flags.Retries, opts); err != nil {
+			logger.Error(err)
+			failed(err)
+
+			// Nothing was output, so this must not look like a success.
+			exitStatus = 1
+		}
+		return
+	}
+
+	if Flags.Resume {
+		var err error
+		if !resumeComplete {
+			err = CatFile(ctx, out, filenames[0], opts)
+			failed(err)
+		} else {
+			// Nothing is left to copy, but the input was still done.
+			summary.done(filenames[0], nil)
+		}
+
+		verifyResumed = err == nil && resumeVerify != nil
+		return
+	}
+
+	if Flags.Prefetch {
+		failed(CatFilesPrefetched(ctx, out, filenames, Flags.PrefetchSize, Flags.FailFast, opts))
+		return
+	}
+
+	if Flags.Jobs > 1 {
+		failed(CatFilesConcurrently(ctx, out, filenames, Flags.Jobs, Flags.JobsSpoolSize, Flags.FailFast, opts))
+		return
+	}
+
+	for _, filename := range filenames {
+		if failed(CatFile(ctx, out, filename, opts)) {
+			break
+		}
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// bufferCloser is an io.WriteCloser that collects everything written to it, for the end of a chain of outputs.
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+// writeSplit writes data to w in pieces of at most size bytes, and then closes it.
+func writeSplit(tb testing.TB, w io.WriteCloser, data []byte, size int) {
+	tb.Helper()
+
+	for len(data) > 0 {
+		n := min(size, len(data))
+
+		if _, err := w.Write(data[:n]); err != nil {
+			tb.Fatalf("Write: %v", err)
+		}
+
+		data = data[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		tb.Fatalf("Close: %v", err)
+	}
+}
+
+// splitSizes are the sizes of the pieces that tests write their input in,
+// so that everything is tested with runes, lines, and line endings split across Writes.
+var splitSizes = []int{1, 2, 3, 7, 64, 1 << 20}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// openAppend opens the given filename for writing, positioned after any content it already has.
+//
+// A local file is simply opened with O_APPEND.
+// The other backends can only create a file anew, truncating it,
+// so its existing content is first spooled to a temporary file, and then written back to the new output.
+// This costs a full round trip of the existing content, but works the same across every backend, including SFTP and S3.
+func openAppend(ctx context.Context, filename string) (files.Writer, error) {
+	if path, isLocal := localPath(filename); isLocal {
+		return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	}
+
+	spool, err := os.CreateTemp("", "allcat-append-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := spool.Close(); err != nil {
+			logger.Error("spool.Close: ", err)
+		}
+
+		if err := os.Remove(spool.Name()); err != nil {
+			logger.Error("spool.Remove: ", err)
+		}
+	}()
+
+	existing, err := readExisting(ctx, spool, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	out, err := files.Create(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing > 0 {
+		if _, err := pooledCopy(ctx, out, spool); err != nil && err != io.EOF {
+			out.Close()
+			return nil, err
+		}
+	}
+
+	if glog.V(2) {
+		logger.Infof("%s: appending after %d existing bytes", filename, existing)
+	}
+
+	return out, nil
+}
+
+// readExisting copies the existing content of the given filename into the spool, and returns how many bytes were copied.
+// A file that does not exist yet has no content, and is not an error.
+func readExisting(ctx context.Context, spool io.Writer, filename string) (int64, error) {
+	in, err := files.Open(ctx, filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	// Some backends only report a missing file once it is read from.
+	n, err := pooledCopy(ctx, spool, in)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return n, err
+	}
+
+	return n, nil
+}
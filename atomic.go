@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+var errOutputDiscarded = errors.New("output discarded, leaving any existing file in place")
+
+// atomicOutput writes to a temporary file, which only replaces the target once it is closed, per --atomic.
+//
+// A local target is written to a temporary file in the same directory, and then renamed over the target,
+// so that a reader of the target only ever sees either all of the old content, or all of the new.
+// No other backend can rename files, so the temporary file is instead a local spool,
+// which is only copied to the target once all of it has been written,
+// in the same way that the http and s3 backends only send an output once it is closed.
+type atomicOutput struct {
+	*os.File
+
+	ctx     context.Context
+	target  string
+	isLocal bool
+
+	// if set, Close removes the temporary file, and leaves the target alone.
+	discard bool
+}
+
+func newAtomicOutput(ctx context.Context, target string) (*atomicOutput, error) {
+	path, isLocal := localPath(target)
+
+	dir, pattern := "", ".allcat-atomic-*"
+	if isLocal {
+		dir, pattern = filepath.Dir(path), "."+filepath.Base(path)+".allcat-*"
+	}
+
+	tmp, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLocal {
+		// A temporary file is created private, but the target should end up as it would have from truncating it, or creating it anew.
+		mode := os.FileMode(0644)
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode().Perm()
+		}
+
+		if err := tmp.Chmod(mode); err != nil {
+			logger.Warningf("%s: %v", tmp.Name(), err)
+		}
+	}
+
+	return &atomicOutput{
+		File:    tmp,
+		ctx:     ctx,
+		target:  target,
+		isLocal: isLocal,
+	}, nil
+}
+
+// Name returns the name of the target, rather than that of the temporary file.
+func (w *atomicOutput) Name() string {
+	return w.target
+}
+
+// Chmod sets the mode of the temporary file of a local target, which the target takes on when it is renamed over it.
+func (w *atomicOutput) Chmod(mode os.FileMode) error {
+	if !w.isLocal {
+		return files.ErrNotSupported
+	}
+
+	return w.File.Chmod(mode)
+}
+
+func (w *atomicOutput) remove() error {
+	err := w.File.Close()
+	if err2 := os.Remove(w.File.Name()); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (w *atomicOutput) Close() error {
+	if w.discard {
+		if err := w.remove(); err != nil {
+			logger.Error("atomic.Remove: ", err)
+		}
+
+		return fmt.Errorf("%s: %w", w.target, errOutputDiscarded)
+	}
+
+	if w.isLocal {
+		if err := w.File.Close(); err != nil {
+			os.Remove(w.File.Name())
+			return err
+		}
+
+		path, _ := localPath(w.target)
+		if err := os.Rename(w.File.Name(), path); err != nil {
+			os.Remove(w.File.Name())
+			return err
+		}
+
+		return nil
+	}
+
+	defer func() {
+		if err := w.remove(); err != nil {
+			logger.Error("atomic.Remove: ", err)
+		}
+	}()
+
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	out, err := files.Create(w.ctx, w.target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pooledCopy(w.ctx, out, w.File); err != nil && err != io.EOF {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// discardOutput marks the given output, as returned from getOutput, to be discarded rather than replace its target, if it is an --atomic output.
+func discardOutput(w io.Writer) {
+	switch w := w.(type) {
+	case *atomicOutput:
+		w.discard = true
+	case *announcedOutput:
+		discardOutput(w.WriteCloser)
+	case *lineFlusher:
+		discardOutput(w.Writer)
+	}
+}
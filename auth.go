@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// passwordEnv is the environment variable that the password for --user is read from, if it is not given in the flag.
+const passwordEnv = "ALLCAT_PASSWORD"
+
+var errNoPassword = errors.New("no password given, and no terminal to prompt on")
+
+// readPassword returns the password for the given user from the passwordEnv environment variable,
+// or else prompts for it on the controlling terminal.
+//
+// The terminal is opened directly, as stdin may well be an input, and stderr may be redirected.
+func readPassword(user string) (string, error) {
+	if pw, ok := os.LookupEnv(passwordEnv); ok {
+		return pw, nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errNoPassword
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "password for %s: ", user)
+	defer fmt.Fprintln(tty)
+
+	pw, err := term.ReadPassword(int(tty.Fd()))
+	if err != nil {
+		return "", err
+	}
+
+	return string(pw), nil
+}
+
+// basicAuth returns a function that returns the value of a basic Authorization header for the given --user value.
+// If it has no password, then the password is read by readPassword, but only once, when it is first needed.
+func basicAuth(userpass string) func() (string, error) {
+	encode := func(user, pw string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pw))
+	}
+
+	if user, pw, found := strings.Cut(userpass, ":"); found {
+		value := encode(user, pw)
+
+		return func() (string, error) {
+			return value, nil
+		}
+	}
+
+	return sync.OnceValues(func() (string, error) {
+		pw, err := readPassword(userpass)
+		if err != nil {
+			return "", err
+		}
+
+		return encode(userpass, pw), nil
+	})
+}
+
+// authTransport adds an Authorization header to each request made through it, unless the request already has one.
+//
+// The header is not sent on to a different host when a request is redirected,
+// just as the http.Client itself drops the header of the original request then.
+type authTransport struct {
+	http.RoundTripper
+	authorization func() (string, error)
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" || !sameHostAsOriginal(req) {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	value, err := t.authorization()
+	if err != nil {
+		return nil, fmt.Errorf("authorization: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", value)
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// sameHostAsOriginal reports whether the given request is to the same host as the request that it was redirected from, if any.
+func sameHostAsOriginal(req *http.Request) bool {
+	orig := req
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+
+	return orig.URL.Host == req.URL.Host
+}
+
+// withAuthorization returns a context, in which http-based files are requested with an Authorization header,
+// whose value is returned by the given function.
+func withAuthorization(ctx context.Context, authorization func() (string, error)) context.Context {
+	return withTransport(ctx, &authTransport{
+		RoundTripper:  transportFrom(ctx),
+		authorization: authorization,
+	})
+}
+
+// withSSHUser returns the given filename with the given user, if it is an sftp or scp URL that does not already name a user.
+func withSSHUser(filename, user string) string {
+	switch schemeOf(filename) {
+	case "sftp", "scp":
+	default:
+		return filename
+	}
+
+	uri, err := url.Parse(filename)
+	if err != nil || uri.User != nil {
+		return filename
+	}
+
+	uri.User = url.User(user)
+
+	return uri.String()
+}
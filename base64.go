@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// base64Encoding returns the base64 alphabet selected by --base64-url.
+func base64Encoding() *base64.Encoding {
+	if Flags.Base64URL {
+		return base64.URLEncoding
+	}
+	return base64.StdEncoding
+}
+
+// spaceSkipper drops all whitespace read from the underlying io.Reader,
+// so that base64 wrapped onto lines, or indented, can still be decoded.
+type spaceSkipper struct {
+	io.Reader
+}
+
+func (r *spaceSkipper) Read(b []byte) (n int, err error) {
+	for n == 0 && err == nil {
+		var m int
+		m, err = r.Reader.Read(b)
+
+		for _, c := range b[:m] {
+			if !isSpace(c) {
+				b[n] = c
+				n++
+			}
+		}
+	}
+
+	return n, err
+}
+
+// base64Encoder base64 encodes everything written to it.
+// Each file is encoded on its own, and ended with a newline, as base64 does,
+// since padding in the middle of a concatenated encoding would make it undecodable.
+type base64Encoder struct {
+	io.WriteCloser
+	out io.Writer
+}
+
+func newBase64Encoder(out io.Writer) *base64Encoder {
+	return &base64Encoder{
+		WriteCloser: base64.NewEncoder(base64Encoding(), out),
+		out:         out,
+	}
+}
+
+// Close flushes any partial block, with padding, and writes the ending newline, but does not close the underlying io.Writer.
+func (w *base64Encoder) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	_, err := w.out.Write([]byte{'\n'})
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// Policies of --binary.
+const (
+	binaryWarn = iota
+	binaryForce
+	binarySkip
+)
+
+// binarySniffSize is the most that is read of the start of an input to decide if it is binary.
+const binarySniffSize = 8192
+
+// guardTerminal is set when the output is a terminal, so that binary inputs are skipped, per --binary.
+var guardTerminal bool
+
+// sniffBinary reads the first chunk of r, and reports whether it holds a NUL byte, as grep does to detect a binary file.
+// The returned io.Reader reads all of r, starting over from that first chunk.
+//
+// Only a single Read is made, so that a streaming input is not held up waiting for more.
+func sniffBinary(r io.Reader) (io.Reader, bool, error) {
+	buf := make([]byte, binarySniffSize)
+
+	n, err := r.Read(buf)
+	buf = buf[:n]
+
+	isBinary := bytes.IndexByte(buf, 0) >= 0
+
+	switch err {
+	case nil:
+	case io.EOF:
+		return bytes.NewReader(buf), isBinary, nil
+	default:
+		return nil, false, err
+	}
+
+	return io.MultiReader(bytes.NewReader(buf), r), isBinary, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// bomStripper drops a UTF-8 byte order mark from the start of the underlying io.Reader.
+//
+// Only the first three bytes are ever inspected, so a BOM anywhere else is passed through.
+type bomStripper struct {
+	io.Reader
+
+	checked bool
+	held    []byte
+}
+
+func (r *bomStripper) Read(b []byte) (n int, err error) {
+	if !r.checked {
+		r.checked = true
+
+		// The first read might be shorter than a BOM, so read until there are enough bytes to tell.
+		head := make([]byte, len(utf8BOM))
+		m, err := io.ReadFull(r.Reader, head)
+		head = head[:m]
+
+		if !bytes.Equal(head, utf8BOM) {
+			r.held = head
+		}
+
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			if len(r.held) == 0 {
+				return 0, io.EOF
+			}
+		default:
+			return 0, err
+		}
+	}
+
+	if len(r.held) > 0 {
+		n = copy(b, r.held)
+		r.held = r.held[n:]
+		return n, nil
+	}
+
+	return r.Reader.Read(b)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// defaultCopyBufferSize is the same size as files.Copy uses, when not given a buffer.
+const defaultCopyBufferSize = 64 * 1024
+
+// copyBuffers pools copy buffers across files, so that catting thousands of files does not allocate a buffer for each.
+// Each buffer is only ever in use by one copy at a time, so this is safe to use from concurrent copies.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		size := copyBufferSize()
+		if size < 1 {
+			size = defaultCopyBufferSize
+		}
+
+		buf := make([]byte, size)
+		return &buf
+	},
+}
+
+// pooledCopy is files.Copy, using a copy buffer from the pool.
+func pooledCopy(ctx context.Context, dst io.Writer, src io.Reader, opts ...files.CopyOption) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+
+	opts = append(opts[:len(opts):len(opts)], files.WithBuffer(*buf))
+
+	return files.Copy(ctx, dst, src, opts...)
+}
+
+// coalescedOutput buffers the many small Writes that line-oriented mutators make, often several for every line,
+// so that they reach the underlying output together, rather than each as a write of its own.
+type coalescedOutput struct {
+	*bufio.Writer
+	out io.WriteCloser
+}
+
+func newCoalescedOutput(out io.WriteCloser) *coalescedOutput {
+	size := copyBufferSize()
+	if size < 1 {
+		size = defaultCopyBufferSize
+	}
+
+	return &coalescedOutput{
+		Writer: bufio.NewWriterSize(out, size),
+		out:    out,
+	}
+}
+
+func (w *coalescedOutput) Close() error {
+	if err := w.Flush(); err != nil {
+		w.out.Close()
+		return err
+	}
+
+	return w.out.Close()
+}
+
+// flushedChain flushes the coalescedOutput at the bottom of a chain of mutators after every Write into the top of the chain.
+// Each copy buffer is written as a single Write, so output is still passed on as soon as it is read,
+// while the per-line Writes within it are amortized into one.
+type flushedChain struct {
+	io.WriteCloser
+	bottom *coalescedOutput
+}
+
+func (w *flushedChain) Write(b []byte) (n int, err error) {
+	n, err = w.WriteCloser.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	return n, w.bottom.Flush()
+}
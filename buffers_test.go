@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// BenchmarkCopySmallFiles compares copying many small files with pooledCopy, against files.Copy allocating a buffer for each file.
+func BenchmarkCopySmallFiles(b *testing.B) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("x"), 512)
+
+	const numFiles = 1000
+
+	copies := []struct {
+		name string
+		copy func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error)
+	}{
+		{"pooled", func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+			return pooledCopy(ctx, dst, src)
+		}},
+		{"unpooled", func(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+			return files.Copy(ctx, dst, src)
+		}},
+	}
+
+	for _, c := range copies {
+		b.Run(fmt.Sprintf("%s/files=%d", c.name, numFiles), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(numFiles * int64(len(content)))
+
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < numFiles; j++ {
+					// Hide WriterTo and ReaderFrom, so that the copy goes through its buffer, as it does for most backends.
+					src := struct{ io.Reader }{bytes.NewReader(content)}
+					dst := struct{ io.Writer }{io.Discard}
+
+					if _, err := c.copy(ctx, dst, src); err != nil && err != io.EOF {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
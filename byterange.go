@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// byteRange is a range of byte offsets, from start inclusive, to end exclusive.
+// If end is negative, then the range extends to the end of the input.
+type byteRange struct {
+	start, end int64
+}
+
+// parseByteRange parses a byte range given as "START-END", or "START-" to read through to the end.
+// Offsets start at zero, START is inclusive, and END is exclusive, so "0-100" is the first 100 bytes.
+func parseByteRange(s string) (*byteRange, error) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return nil, fmt.Errorf("bad byte range %q: expected START-END", s)
+	}
+
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("bad byte range %q: bad start", s)
+	}
+
+	end := int64(-1)
+	if to != "" {
+		end, err = strconv.ParseInt(to, 10, 64)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("bad byte range %q: bad end", s)
+		}
+	}
+
+	return &byteRange{
+		start: start,
+		end:   end,
+	}, nil
+}
+
+// rangeHeader renders the byte range as the value of an HTTP Range header, whose end is inclusive.
+func (br *byteRange) rangeHeader() string {
+	if br.end < 0 {
+		return fmt.Sprintf("bytes=%d-", br.start)
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", br.start, br.end-1)
+}
+
+// rangeTransport adds a Range header to each GET request made through it.
+//
+// httpfiles treats any status other than 200 OK as an error,
+// so a 206 Partial Content response is passed on as a 200 OK.
+// Its Content-Range header is left in place, which is how the caller knows that the body starts at the range start.
+type rangeTransport struct {
+	http.RoundTripper
+	header string
+}
+
+func (t *rangeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet {
+		req = req.Clone(req.Context())
+		req.Header.Set("Range", t.header)
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+	}
+
+	return resp, nil
+}
+
+// withRangeRequests returns a context, in which http-based files are requested with only the given byte range.
+func withRangeRequests(ctx context.Context, br *byteRange) context.Context {
+	return withTransport(ctx, &rangeTransport{
+		RoundTripper: transportFrom(ctx),
+		header:       br.rangeHeader(),
+	})
+}
+
+// isRanged reports whether the backend already honored a Range request for the input,
+// so that it starts at the range start, and its size is that of the range alone.
+func isRanged(in io.Reader) bool {
+	h, ok := in.(interface{ Header() (http.Header, error) })
+	if !ok {
+		return false
+	}
+
+	header, err := h.Header()
+	return err == nil && header.Get("Content-Range") != ""
+}
+
+// seekRange positions the input at the start of the byte range, and returns a reader limited to the byte range.
+//
+// If the backend already honored a Range request, then the input is already at the start.
+// Otherwise, the input is seeked if it can be, and if it cannot, then everything up to the start is read and discarded.
+func seekRange(in io.ReadSeeker, br *byteRange) (io.Reader, error) {
+	switch {
+	case isRanged(in), br.start == 0:
+	default:
+		if _, err := in.Seek(br.start, io.SeekStart); err != nil {
+			if glog.V(5) {
+				logger.Infof("cannot seek, discarding %d bytes: %v", br.start, err)
+			}
+
+			if _, err := io.CopyN(io.Discard, in, br.start); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+
+	if br.end < 0 {
+		return in, nil
+	}
+
+	return io.LimitReader(in, br.end-br.start), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/puellanivis/breton/lib/display/tables"
+)
+
+// byteStats is an io.Writer that counts the frequency of each byte value written to it.
+type byteStats struct {
+	counts [256]int64
+	total  int64
+}
+
+func (s *byteStats) Write(b []byte) (n int, err error) {
+	for _, c := range b {
+		s.counts[c]++
+	}
+	s.total += int64(len(b))
+
+	return len(b), nil
+}
+
+// entropy returns the Shannon entropy of the bytes counted so far, in bits per byte.
+func (s *byteStats) entropy() float64 {
+	if s.total < 1 {
+		return 0
+	}
+
+	var h float64
+	for _, count := range s.counts {
+		if count < 1 {
+			continue
+		}
+
+		p := float64(count) / float64(s.total)
+		h -= p * math.Log2(p)
+	}
+
+	return h
+}
+
+// caretNotation renders the given byte the same way as --show-nonprinting would.
+func caretNotation(c byte) string {
+	var prefix string
+	if c >= 128 {
+		prefix = "M-"
+		c -= 128
+	}
+
+	switch {
+	case c == ' ':
+		return prefix + "SP"
+	case c < 32:
+		return prefix + "^" + string(rune(c+'@'))
+	case c == 127:
+		return prefix + "^?"
+	}
+
+	return prefix + string(rune(c))
+}
+
+type byteStatsRow struct {
+	Byte  int    `json:"byte"`
+	Char  string `json:"char"`
+	Count int64  `json:"count"`
+}
+
+type byteStatsSummary struct {
+	Total   int64          `json:"total"`
+	Entropy float64        `json:"entropy_bits_per_byte"`
+	Bytes   []byteStatsRow `json:"bytes"`
+}
+
+// writeTable writes out the frequency of every one of the 256 byte values, followed by a summary with the entropy estimate.
+func (s *byteStats) writeTable(w io.Writer, asJSON bool) error {
+	if asJSON {
+		summary := &byteStatsSummary{
+			Total:   s.total,
+			Entropy: s.entropy(),
+			Bytes:   make([]byteStatsRow, len(s.counts)),
+		}
+
+		for i, count := range s.counts {
+			summary.Bytes[i] = byteStatsRow{
+				Byte:  i,
+				Char:  caretNotation(byte(i)),
+				Count: count,
+			}
+		}
+
+		return json.NewEncoder(w).Encode(summary)
+	}
+
+	var t tables.Table
+	t = tables.Append(t, "byte", "char", "count", "percent")
+
+	for i, count := range s.counts {
+		var percent float64
+		if s.total > 0 {
+			percent = 100 * float64(count) / float64(s.total)
+		}
+
+		t = tables.Append(t, fmt.Sprintf("0x%02x", i), caretNotation(byte(i)), count, fmt.Sprintf("%.3f%%", percent))
+	}
+
+	if err := tables.Empty.WriteSimple(w, t); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "total: %d bytes, entropy: %.4f bits/byte\n", s.total, s.entropy())
+	return err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// Handling of undecodable bytes, and unencodable characters, selectable by --on-invalid.
+const (
+	invalidReplace = iota
+	invalidError
+	invalidSkip
+)
+
+var errInvalidCharset = errors.New("invalid character for charset")
+
+// fromCharset and toCharset are the encodings given by --from-charset and --to-charset, or nil if they are UTF-8.
+var fromCharset, toCharset encoding.Encoding
+
+// lookupCharset returns the encoding of the given charset name, like latin1, shift_jis, or utf-8.
+//
+// IANA names are tried first, so that latin1 is ISO-8859-1, rather than windows-1252 as the WHATWG would have it.
+func lookupCharset(name string) (encoding.Encoding, error) {
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown charset %q", name)
+	}
+
+	return enc, nil
+}
+
+// charsetDecoder returns a transform from the given encoding into UTF-8.
+//
+// Decoders replace undecodable bytes with U+FFFD, so to skip or reject them, it is U+FFFD that is skipped or rejected.
+// This cannot be told apart from a U+FFFD that was actually in the input, but only a Unicode charset can encode one.
+func charsetDecoder(enc encoding.Encoding, onInvalid int) transform.Transformer {
+	switch onInvalid {
+	case invalidError:
+		return transform.Chain(enc.NewDecoder(), rejectRuneError{})
+	case invalidSkip:
+		return transform.Chain(enc.NewDecoder(), skipRuneError{})
+	}
+
+	return enc.NewDecoder()
+}
+
+// charsetEncoder returns a transform from UTF-8 into the given encoding.
+func charsetEncoder(enc encoding.Encoding, onInvalid int) transform.Transformer {
+	switch onInvalid {
+	case invalidError:
+		return enc.NewEncoder()
+	case invalidSkip:
+		return &skipUnsupported{
+			Transformer: enc.NewEncoder(),
+		}
+	}
+
+	return encoding.ReplaceUnsupported(enc.NewEncoder())
+}
+
+// rejectRuneError is a transform of UTF-8 that fails at the first U+FFFD.
+type rejectRuneError struct {
+	transform.NopResetter
+}
+
+func (rejectRuneError) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError {
+			return nDst, nSrc, errInvalidCharset
+		}
+
+		if nDst+size > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+
+		nDst += copy(dst[nDst:], src[nSrc:nSrc+size])
+		nSrc += size
+	}
+
+	return nDst, nSrc, nil
+}
+
+// skipRuneError is a transform of UTF-8 that drops every U+FFFD.
+type skipRuneError struct {
+	transform.NopResetter
+}
+
+func (skipRuneError) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if r == utf8.RuneError {
+			nSrc += size
+			continue
+		}
+
+		if nDst+size > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+
+		nDst += copy(dst[nDst:], src[nSrc:nSrc+size])
+		nSrc += size
+	}
+
+	return nDst, nSrc, nil
+}
+
+// skipUnsupported wraps an encoder, to drop every character that it cannot encode, rather than failing.
+// The encoders of x/text report such a character with an error that knows what to replace it with,
+// which is how encoding.ReplaceUnsupported finds them as well.
+type skipUnsupported struct {
+	transform.Transformer
+}
+
+func (t *skipUnsupported) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for {
+		n, m, err := t.Transformer.Transform(dst[nDst:], src[nSrc:], atEOF)
+		nDst += n
+		nSrc += m
+
+		var unsupported interface{ Replacement() byte }
+		if !errors.As(err, &unsupported) {
+			return nDst, nSrc, err
+		}
+
+		_, size := utf8.DecodeRune(src[nSrc:])
+		nSrc += size
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+var hashes = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// hashBySize maps the length of a hex-encoded digest to the algorithm that produces it.
+var hashBySize = map[int]string{
+	8:   "crc32",
+	32:  "md5",
+	40:  "sha1",
+	64:  "sha256",
+	128: "sha512",
+}
+
+type digest struct {
+	algo string
+	sum  []byte
+}
+
+// parseDigest parses an expected digest of the form "algorithm:hex".
+// If no algorithm is given, it is inferred from the length of the hex digest.
+func parseDigest(s string) (*digest, error) {
+	algo, sum, found := strings.Cut(s, ":")
+	if !found {
+		sum = algo
+		algo = hashBySize[len(sum)]
+	}
+
+	algo = strings.ToLower(algo)
+	if _, ok := hashes[algo]; !ok {
+		return nil, fmt.Errorf("unknown checksum algorithm for digest %q", s)
+	}
+
+	b, err := hex.DecodeString(sum)
+	if err != nil {
+		return nil, fmt.Errorf("bad digest %q: %w", s, err)
+	}
+
+	return &digest{
+		algo: algo,
+		sum:  b,
+	}, nil
+}
+
+func (d *digest) String() string {
+	return d.algo + ":" + hex.EncodeToString(d.sum)
+}
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// spoolFile copies the given filename into the spool, and returns the digest of what was copied.
+//
+// The input is opened as CatFile opens it, but without any retries, as VerifyCatFile retries the whole download instead.
+func spoolFile(ctx context.Context, spool io.Writer, filename string, algo string, opts []files.CopyOption) (*digest, error) {
+	in, err := openCatInput(ctx, filename, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	h := hashes[algo]()
+
+	if _, err := pooledCopy(ctx, io.MultiWriter(spool, h), in, opts...); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &digest{
+		algo: algo,
+		sum:  h.Sum(nil),
+	}, nil
+}
+
+// VerifyCatFile prints the given filename out to the given io.Writer, but only once its content matches the expected digest.
+//
+// The content is spooled to a temporary file while it is hashed, so that a corrupted transfer never reaches the output.
+// On a mismatch, the transfer is assumed to have been corrupted in transit, and the file is downloaded again,
+// as it is on a transient error opening or transferring it, up to the given number of retries in all.
+func VerifyCatFile(ctx context.Context, out io.Writer, filename string, expected *digest, retries uint, opts []files.CopyOption) (err error) {
+	defer func() {
+		summary.done(filename, err)
+	}()
+
+	spool, err := os.CreateTemp("", "allcat-verify-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := spool.Close(); err != nil {
+			logger.Error("spool.Close: ", err)
+		}
+
+		if err := os.Remove(spool.Name()); err != nil {
+			logger.Error("spool.Remove: ", err)
+		}
+	}()
+
+	start := time.Now()
+
+	for attempt := uint(0); ; attempt++ {
+		if attempt > 0 {
+			if _, err := spool.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			if err := spool.Truncate(0); err != nil {
+				return err
+			}
+		}
+
+		actual, err := spoolFile(ctx, spool, filename, expected.algo, opts)
+		if err == nil && bytes.Equal(actual.sum, expected.sum) {
+			break
+		}
+
+		if err != nil && (attempt >= retries || !isTransient(err)) {
+			return err
+		}
+
+		if err == nil && attempt >= retries {
+			return fmt.Errorf("%s: %w: expected %v, got %v", filename, errChecksumMismatch, expected, actual)
+		}
+
+		if err == nil {
+			logger.Warningf("%s: checksum mismatch: expected %v, got %v; retrying (%d of %d)", filename, expected, actual, attempt+1, retries)
+			continue
+		}
+
+		delay := retryDelay(Flags.RetryBackoff, attempt)
+		logger.Warningf("%s: %v; retrying in %v (%d of %d)", filename, err, delay, attempt+1, retries)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	n, err := pooledCopy(ctx, out, spool)
+	summary.copied(n)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if glog.V(2) {
+		logger.Infof("%s: %d bytes verified and copied in %v", filename, n, time.Since(start))
+	}
+
+	return nil
+}
+
+// checksumFile returns the digest of the content of the given filename, and how many bytes of it were read.
+func checksumFile(ctx context.Context, filename string, algo string, opts []files.CopyOption) ([]byte, int64, error) {
+	in, err := openCatInput(ctx, filename, Flags.Retries)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	h := hashes[algo]()
+
+	n, err := pooledCopy(ctx, h, in, opts...)
+	if err != nil && err != io.EOF {
+		return nil, n, err
+	}
+
+	return h.Sum(nil), n, nil
+}
+
+// checksumLine renders a single line of a checksum manifest, in the coreutils sha256sum format.
+//
+// As coreutils does, a filename containing a backslash or newline is escaped, and the line is then marked by a leading backslash.
+func checksumLine(sum []byte, filename string) string {
+	var prefix string
+	if strings.ContainsAny(filename, "\\\n\r") {
+		prefix = "\\"
+		filename = checksumEscaper.Replace(filename)
+	}
+
+	return fmt.Sprintf("%s%x  %s\n", prefix, sum, filename)
+}
+
+var checksumEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+// CatChecksumFile prints the given filename out to the given io.Writer, as CatFile does,
+// and also prints its checksum manifest line to the given manifest io.Writer.
+// The checksum is of the content as read, before any mutators are applied.
+func CatChecksumFile(ctx context.Context, out, manifest io.Writer, filename string, algo string, opts []files.CopyOption) error {
+	h := hashes[algo]()
+
+	if err := CatFile(ctx, io.MultiWriter(out, h), filename, opts); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(manifest, checksumLine(h.Sum(nil), filename))
+	return err
+}
+
+type checksumResult struct {
+	sum []byte
+	err error
+}
+
+// ChecksumManifest prints a checksum manifest of the given filenames to the given io.Writer,
+// in the same format as the coreutils sha256sum family, so that it can be checked with `sha256sum -c`.
+//
+// Up to parallel files are hashed at once, which bounds the number of open files,
+// but the manifest lines are always written in input order.
+// A failure is reported for its file, and does not abort the rest of the manifest.
+func ChecksumManifest(ctx context.Context, out io.Writer, filenames []string, algo string, parallel uint, opts []files.CopyOption) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]chan checksumResult, len(filenames))
+	for i := range results {
+		results[i] = make(chan checksumResult, 1)
+	}
+
+	next := make(chan int)
+
+	go func() {
+		defer close(next)
+
+		for i := range filenames {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := uint(0); w < parallel; w++ {
+		go func() {
+			for i := range next {
+				sum, n, err := checksumFile(ctx, filenames[i], algo, opts)
+				summary.copied(n)
+				summary.done(filenames[i], err)
+
+				results[i] <- checksumResult{
+					sum: sum,
+					err: err,
+				}
+			}
+		}()
+	}
+
+	for i, filename := range filenames {
+		var res checksumResult
+
+		select {
+		case res = <-results[i]:
+		case <-ctx.Done():
+			logger.Error(ctx.Err())
+			return
+		}
+
+		if res.err != nil {
+			logger.Errorf("%s: %v", filename, res.err)
+			continue
+		}
+
+		if _, err := io.WriteString(out, checksumLine(res.sum, filename)); err != nil {
+			logger.Error(err)
+			return
+		}
+	}
+}
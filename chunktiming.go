@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/puellanivis/breton/lib/display/tables"
+)
+
+// chunkTimer records the wall-clock time between successive Reads from the underlying io.Reader.
+// The first gap is measured from when the chunkTimer is created, giving the time to first byte.
+type chunkTimer struct {
+	io.Reader
+
+	last time.Time
+	gaps []time.Duration
+}
+
+func newChunkTimer(r io.Reader) *chunkTimer {
+	return &chunkTimer{
+		Reader: r,
+		last:   time.Now(),
+	}
+}
+
+func (r *chunkTimer) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+
+	now := time.Now()
+	r.gaps = append(r.gaps, now.Sub(r.last))
+	r.last = now
+
+	return n, err
+}
+
+// percentile returns the p-th percentile of the given sorted durations, using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) < 1 {
+		return 0
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+type chunkTimingSummary struct {
+	File  string  `json:"file"`
+	Reads int     `json:"reads"`
+	Min   float64 `json:"min_seconds"`
+	Max   float64 `json:"max_seconds"`
+	P50   float64 `json:"p50_seconds"`
+	P99   float64 `json:"p99_seconds"`
+}
+
+// writeSummary writes out the min/max/p50/p99 inter-chunk latency of the reads recorded so far.
+func (r *chunkTimer) writeSummary(w io.Writer, name string, asJSON bool) error {
+	sorted := make([]time.Duration, len(r.gaps))
+	copy(sorted, r.gaps)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var min, max time.Duration
+	if len(sorted) > 0 {
+		min, max = sorted[0], sorted[len(sorted)-1]
+	}
+
+	p50, p99 := percentile(sorted, 0.50), percentile(sorted, 0.99)
+
+	if asJSON {
+		return json.NewEncoder(w).Encode(&chunkTimingSummary{
+			File:  name,
+			Reads: len(sorted),
+			Min:   min.Seconds(),
+			Max:   max.Seconds(),
+			P50:   p50.Seconds(),
+			P99:   p99.Seconds(),
+		})
+	}
+
+	var t tables.Table
+	t = tables.Append(t, "file", "reads", "min", "max", "p50", "p99")
+	t = tables.Append(t, name, len(sorted), min, max, p50, p99)
+
+	return tables.Empty.WriteSimple(w, t)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Output compression formats, selectable by --compress.
+const (
+	compressOutputNone = iota
+	compressOutputGzip
+)
+
+// compressedOutput compresses everything written to it, before writing it to the underlying output.
+type compressedOutput struct {
+	*gzip.Writer
+	out io.WriteCloser
+}
+
+// newCompressedOutput returns an output that gzip compresses at the given level, from gzip.HuffmanOnly to gzip.BestCompression.
+func newCompressedOutput(out io.WriteCloser, level int) (*compressedOutput, error) {
+	zw, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressedOutput{
+		Writer: zw,
+		out:    out,
+	}, nil
+}
+
+// encodeOutput applies --compress, and then --add-bom, to the output of a single file, as of --output-hashed or --output-template,
+// in the same way that main applies them to the one output of everything else.
+// The returned output is still to be wrapped by wrapOutput, and on an error, the given output is left for the caller to close.
+func encodeOutput(out io.WriteCloser) (io.WriteCloser, error) {
+	if Flags.Compress == compressOutputGzip {
+		zw, err := newCompressedOutput(out, Flags.CompressLevel)
+		if err != nil {
+			return nil, fmt.Errorf("bad --compress-level: %w", err)
+		}
+
+		out = zw
+	}
+
+	if Flags.AddBOM {
+		if _, err := out.Write(utf8BOM); err != nil {
+			return nil, fmt.Errorf("add-bom: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+// Close finishes the compressed stream, and only then closes the underlying output,
+// so that the trailer of the stream is written before it is closed.
+func (w *compressedOutput) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		w.out.Close()
+		return err
+	}
+
+	return w.out.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// wordCounter is an io.Writer that counts the lines, words, and bytes written to it, like wc.
+//
+// A word is a maximal run of non-whitespace bytes, and a word split across Writes is only counted once.
+type wordCounter struct {
+	lines, words, bytes int64
+
+	inWord bool
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+func (c *wordCounter) Write(b []byte) (n int, err error) {
+	for _, ch := range b {
+		if ch == '\n' {
+			c.lines++
+		}
+
+		if isSpace(ch) {
+			c.inWord = false
+			continue
+		}
+
+		if !c.inWord {
+			c.words++
+			c.inWord = true
+		}
+	}
+	c.bytes += int64(len(b))
+
+	return len(b), nil
+}
+
+// add tallies the counts of another wordCounter into this one.
+func (c *wordCounter) add(o *wordCounter) {
+	c.lines += o.lines
+	c.words += o.words
+	c.bytes += o.bytes
+}
+
+// countWidth returns the width of the columns of --count, as wc sizes them for regular files: wide enough for the largest count.
+// Since no count is larger than the total of the bytes, the width of that is the width of every column.
+func countWidth(total *wordCounter) int {
+	return len(strconv.FormatInt(total.bytes, 10))
+}
+
+// writeCounts writes a single wc-style line of lines, words, and bytes for the given name, with columns of the given width.
+func (c *wordCounter) writeCounts(w io.Writer, name string, width int) error {
+	_, err := fmt.Fprintf(w, "%*d %*d %*d %s\n", width, c.lines, width, c.words, width, c.bytes, name)
+	return err
+}
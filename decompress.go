@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Decompression modes.
+const (
+	decompressAuto = iota
+	decompressNever
+	decompressAlways
+)
+
+// Compression formats.
+const (
+	compressionNone = iota
+	compressionGzip
+	compressionBzip2
+	compressionZstd
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// zstdAvailable reports whether the external zstd command, which zstd is decompressed through, is installed.
+var zstdAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("zstd")
+	return err == nil
+})
+
+// magicLen is how many bytes need to be peeked to detect a compression format.
+const magicLen = 4
+
+// compressionOf detects the compression format of an input from its first bytes.
+//
+// bzip2 has no reliable short magic, so it is instead detected by its extension,
+// unless decompression is explicitly asked for.
+// gzip and zstd are never detected by their extension, so that a plain file that happens to be named .gz is passed through as is.
+func compressionOf(name string, magic []byte) int {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(magic, zstdMagic):
+		return compressionZstd
+	}
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".bz2", ".tbz2":
+		return compressionBzip2
+	}
+
+	return compressionNone
+}
+
+var errUnknownCompression = errors.New("unknown compression format")
+
+// decompress transparently decompresses a compressed input.
+// With decompressAuto, an input of no known compression format is passed through as is,
+// while with decompressAlways, it is an error.
+//
+// The returned io.ReadCloser must be closed, to release any decoder, but its Close does not close the input.
+func decompress(ctx context.Context, r io.Reader, name string, mode int) (io.ReadCloser, error) {
+	if mode == decompressNever {
+		return io.NopCloser(r), nil
+	}
+
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(magicLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	format := compressionOf(name, magic)
+	if format == compressionNone && mode == decompressAlways && bytes.HasPrefix(magic, bzip2Magic) {
+		format = compressionBzip2
+	}
+
+	switch format {
+	case compressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		// concatenated gzip members are decompressed as one stream, the same as gunzip does.
+		zr.Multistream(true)
+
+		return zr, nil
+
+	case compressionBzip2:
+		// The bzip2 reader needs no Close, closing the input is enough.
+		return io.NopCloser(bzip2.NewReader(br)), nil
+
+	case compressionZstd:
+		// Only an explicit --decompress=always should fail on an input that just happens to start with the zstd magic.
+		if mode == decompressAuto && !zstdAvailable() {
+			logger.Warningf("%s: zstd is not installed, passing the input through as is", name)
+			return io.NopCloser(br), nil
+		}
+
+		return newZstdReader(ctx, br)
+	}
+
+	if mode == decompressAlways {
+		return nil, errUnknownCompression
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// zstdReader decompresses zstd through the external zstd command, as the standard library has no zstd decoder.
+type zstdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+
+	waited bool
+	err    error
+}
+
+func newZstdReader(ctx context.Context, r io.Reader) (*zstdReader, error) {
+	cmd := exec.CommandContext(ctx, "zstd", "--decompress", "--stdout", "--quiet")
+	cmd.Stdin = r
+	if !Flags.Quiet {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("zstd: %w", err)
+	}
+
+	return &zstdReader{
+		ReadCloser: stdout,
+		cmd:        cmd,
+	}, nil
+}
+
+func (z *zstdReader) wait() error {
+	if !z.waited {
+		z.waited = true
+
+		if err := z.cmd.Wait(); err != nil {
+			z.err = fmt.Errorf("zstd: %w", err)
+		}
+	}
+
+	return z.err
+}
+
+func (z *zstdReader) Read(b []byte) (n int, err error) {
+	n, err = z.ReadCloser.Read(b)
+	if err == io.EOF {
+		// a corrupt stream just ends early, so only how zstd exits tells us whether it was complete.
+		if err := z.wait(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
+
+// Close stops the zstd command, even if the stream has not been read to the end, and waits for it to exit.
+func (z *zstdReader) Close() error {
+	if z.waited {
+		return nil
+	}
+
+	z.ReadCloser.Close()
+
+	if err := z.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+
+	// as we killed it, it exiting with an error is expected.
+	_ = z.wait()
+	return nil
+}
+
+// isCompressed reports whether a seekable input would be decompressed, and then seeks back to the start.
+// An input that cannot seek is reported as not compressed, having read nothing.
+func isCompressed(in io.ReadSeeker, name string) (bool, error) {
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return false, nil
+	}
+
+	magic := make([]byte, magicLen)
+	n, err := io.ReadFull(in, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	switch compressionOf(name, magic[:n]) {
+	case compressionNone:
+		return false, nil
+	case compressionZstd:
+		// decompress passes it through as is, if zstd is not installed.
+		return zstdAvailable(), nil
+	}
+
+	return true, nil
+}
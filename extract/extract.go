@@ -0,0 +1,104 @@
+// Package extract defines a registry of TextExtractors, which turn documents into plain text.
+//
+// Like lib/files schemes, extractors are registered by their implementing packages at init time,
+// so that importing a package for its side-effects makes the extractor available.
+package extract
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SniffLen is the maximum number of bytes that Sniff will consider.
+const SniffLen = 512
+
+// TextExtractor defines an interface which turns a document into plain text.
+type TextExtractor interface {
+	// Extract returns a reader of the plain text content of the document read from r.
+	Extract(ctx context.Context, r io.Reader) (io.Reader, error)
+}
+
+var registry struct {
+	sync.Mutex
+
+	m      map[string]TextExtractor
+	keys   []string
+	sorted bool
+}
+
+// Register takes a TextExtractor and attaches to it the given names so that
+// Lookup will return that TextExtractor for any of those names.
+// Names should include the MIME types that the TextExtractor handles,
+// as these are used when sniffing the content.
+func Register(x TextExtractor, names ...string) {
+	if len(names) < 1 {
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.m == nil {
+		registry.m = make(map[string]TextExtractor)
+	}
+	registry.sorted = false
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+
+		if _, ok := registry.m[name]; ok {
+			// first registration wins.
+			continue
+		}
+
+		registry.m[name] = x
+		registry.keys = append(registry.keys, name)
+	}
+}
+
+// Lookup returns the TextExtractor registered under the given name.
+func Lookup(name string) (TextExtractor, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.m == nil {
+		return nil, false
+	}
+
+	x, ok := registry.m[strings.ToLower(name)]
+	return x, ok
+}
+
+// Sniff detects the MIME type of the given leading bytes of a document,
+// and returns the TextExtractor registered for that MIME type.
+func Sniff(head []byte) (x TextExtractor, mimeType string, ok bool) {
+	if len(head) > SniffLen {
+		head = head[:SniffLen]
+	}
+
+	mimeType = http.DetectContentType(head)
+	if mt, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mt
+	}
+
+	x, ok = Lookup(mimeType)
+	return x, mimeType, ok
+}
+
+// Registered returns a slice of strings that describe all registered names.
+func Registered() []string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if !registry.sorted {
+		sort.Strings(registry.keys)
+		registry.sorted = true
+	}
+
+	return registry.keys
+}
@@ -0,0 +1,20 @@
+// Package plaintext implements an extract.TextExtractor that passes plain text through untouched.
+package plaintext
+
+import (
+	"context"
+	"io"
+
+	"github.com/puellanivis/allcat/extract"
+)
+
+type passthrough struct{}
+
+func init() {
+	extract.Register(passthrough{}, "text", "text/plain")
+}
+
+// Extract returns the given reader, as plain text is already plain text.
+func (passthrough) Extract(ctx context.Context, r io.Reader) (io.Reader, error) {
+	return r, nil
+}
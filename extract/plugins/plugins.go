@@ -0,0 +1,10 @@
+// Package plugins is imported for side-effects and includes default extract plugins.
+//
+// Format-specific extractors with heavier dependencies (e.g. PDF) are not included here,
+// and should be imported separately for their side-effects.
+package plugins
+
+import (
+	// this includes all default plugins for extract
+	_ "github.com/puellanivis/allcat/extract/plaintext"
+)
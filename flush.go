@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// lineFlusher syncs the underlying output after every write that ends a line, for --line-buffered,
+// so that a streaming input, like server-sent events, is passed on a line at a time, rather than as buffers fill.
+type lineFlusher struct {
+	files.Writer
+}
+
+func (w *lineFlusher) Write(b []byte) (n int, err error) {
+	n, err = w.Writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	if bytes.IndexByte(b[:n], '\n') >= 0 {
+		if err := w.Writer.Sync(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
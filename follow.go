@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// followFile streams out the bytes appended to the given input after everything already catted from it,
+// polling for growth at every interval, like tail -f, until the context is done.
+//
+// A local file is kept open, and read onward from where the cat left off.
+// Other backends cannot be read past what they first returned, so each poll re-opens the file,
+// and only the newly appended bytes are fetched with catRange.
+// The appended bytes go straight to the output, and are not passed through any input filters.
+//
+// If the file shrinks, it is assumed to have been truncated, and is followed again from its start.
+func followFile(ctx context.Context, out io.Writer, filename string, in files.Reader, interval time.Duration, opts []files.CopyOption) error {
+	switch filename {
+	case "", "-", "/dev/stdin":
+		// a stream cannot grow after it has ended.
+		return nil
+	}
+
+	_, isLocal := localPath(filename)
+
+	var offset int64
+	if isLocal {
+		off, err := in.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		offset = off
+
+	} else {
+		info, err := in.Stat()
+		if err != nil {
+			return err
+		}
+		offset = info.Size()
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		size, err := followSize(ctx, filename, in, isLocal)
+		if err != nil {
+			logger.Errorf("%s: %v", filename, err)
+			continue
+		}
+
+		if size < offset {
+			logger.Warningf("%s: file truncated", filename)
+			offset = 0
+
+			if isLocal {
+				if _, err := in.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+			}
+		}
+
+		if size <= offset {
+			continue
+		}
+
+		var n int64
+		if isLocal {
+			n, err = pooledCopy(ctx, out, in, opts...)
+			if err == io.EOF {
+				err = nil
+			}
+
+		} else {
+			n, err = catRange(ctx, out, filename, offset, size, opts)
+		}
+
+		offset += n
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		if glog.V(5) {
+			logger.Infof("%s: followed %d more bytes", filename, n)
+		}
+	}
+}
+
+// followSize returns the current size of the followed file.
+// A local file is stat'd through its open file, while any other backend must be re-opened to see its new size.
+func followSize(ctx context.Context, filename string, in files.Reader, isLocal bool) (int64, error) {
+	if isLocal {
+		info, err := in.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		return info.Size(), nil
+	}
+
+	f, err := files.Open(ctx, filename)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Input framings.
+//
+//   - newline: each frame is terminated by a '\n', the final frame may be unterminated.
+//   - nul: each frame is terminated by a NUL byte, the final frame may be unterminated.
+//   - length-prefixed: each frame is a 4-byte big-endian unsigned length, followed by exactly that many bytes of frame data.
+const (
+	frameNone = iota
+	frameNewline
+	frameNUL
+	frameLengthPrefixed
+)
+
+var errTruncatedFrame = errors.New("truncated frame")
+
+// parseFrameSeparator interprets the Go escapes of --frame-separator.
+// As a NUL is the most obvious separator, a lone \0 is also accepted for it, as printf and tr do, though Go itself only accepts \000.
+func parseFrameSeparator(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == '0' && !completesOctal(s[i+2:]) {
+			b.WriteString(`\x00`)
+		} else {
+			// every other escape, including an escaped backslash, is left to strconv.Unquote.
+			b.WriteString(s[i : i+2])
+		}
+
+		i++
+	}
+
+	return strconv.Unquote(`"` + b.String() + `"`)
+}
+
+// completesOctal reports whether s starts with the two more octal digits that complete a Go octal escape begun by \0, like \000.
+func completesOctal(s string) bool {
+	return len(s) >= 2 && '0' <= s[0] && s[0] <= '7' && '0' <= s[1] && s[1] <= '7'
+}
+
+// frameReader splits the underlying input into frames, and yields each frame followed by a separator.
+// This turns framed input into records which the line-oriented transforms can work with.
+type frameReader struct {
+	r       *bufio.Reader
+	framing int
+	sep     []byte
+
+	// pending holds bytes ready to be returned by Read.
+	pending []byte
+	buf     []byte
+
+	// for length-prefixed framing, the number of bytes left in the current frame.
+	inFrame   bool
+	remaining int64
+
+	err error
+}
+
+func newFrameReader(r io.Reader, framing int, sep []byte) *frameReader {
+	return &frameReader{
+		r:       bufio.NewReader(r),
+		framing: framing,
+		sep:     sep,
+	}
+}
+
+func (f *frameReader) Read(b []byte) (n int, err error) {
+	for {
+		if len(f.pending) > 0 {
+			n = copy(b, f.pending)
+			f.pending = f.pending[n:]
+			return n, nil
+		}
+
+		if f.err != nil {
+			return 0, f.err
+		}
+
+		if f.framing == frameLengthPrefixed {
+			n, err := f.readLengthPrefixed(b)
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		f.readDelimited()
+	}
+}
+
+func (f *frameReader) readLengthPrefixed(b []byte) (n int, err error) {
+	if !f.inFrame {
+		var hdr [4]byte
+
+		if _, err := io.ReadFull(f.r, hdr[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = errTruncatedFrame
+			}
+
+			f.err = err
+			return 0, err
+		}
+
+		f.inFrame = true
+		f.remaining = int64(binary.BigEndian.Uint32(hdr[:]))
+	}
+
+	if f.remaining == 0 {
+		f.inFrame = false
+		f.pending = f.sep
+		return 0, nil
+	}
+
+	if int64(len(b)) > f.remaining {
+		b = b[:f.remaining]
+	}
+
+	n, err = f.r.Read(b)
+	f.remaining -= int64(n)
+
+	if err == io.EOF {
+		err = nil
+
+		if f.remaining > 0 {
+			f.err = errTruncatedFrame
+		}
+	}
+
+	return n, err
+}
+
+func (f *frameReader) readDelimited() {
+	delim := byte('\n')
+	if f.framing == frameNUL {
+		delim = 0
+	}
+
+	chunk, err := f.r.ReadSlice(delim)
+
+	switch {
+	case err == nil:
+		// a whole frame: replace its delimiter with the separator.
+		f.buf = append(append(f.buf[:0], chunk[:len(chunk)-1]...), f.sep...)
+
+	case err == bufio.ErrBufferFull:
+		// the frame continues past the buffer.
+		f.buf = append(f.buf[:0], chunk...)
+
+	default:
+		f.err = err
+		f.buf = f.buf[:0]
+
+		if len(chunk) > 0 {
+			// an unterminated final frame.
+			f.buf = append(append(f.buf, chunk...), f.sep...)
+		}
+	}
+
+	f.pending = f.buf
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// readFrames reads all of in through a frameReader, with reads of at most size bytes on both sides of it.
+func readFrames(in string, framing int, sep string, size int) (string, error) {
+	r := newFrameReader(iotest.HalfReader(strings.NewReader(in)), framing, []byte(sep))
+
+	var out strings.Builder
+	buf := make([]byte, size)
+
+	for {
+		n, err := r.Read(buf)
+		out.Write(buf[:n])
+
+		if err == io.EOF {
+			return out.String(), nil
+		}
+		if err != nil {
+			return out.String(), err
+		}
+	}
+}
+
+// readSizes are the sizes of the reads made from a frameReader, so that frames, and separators, are split across reads.
+var readSizes = []int{1, 2, 3, 7, 64, 1 << 16}
+
+type framingTest struct {
+	name    string
+	in      string
+	sep     string
+	want    string
+	wantErr error
+}
+
+func testFraming(t *testing.T, framing int, tests []framingTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		for _, size := range readSizes {
+			t.Run(fmt.Sprintf("%s/read=%d", tt.name, size), func(t *testing.T) {
+				got, err := readFrames(tt.in, framing, tt.sep, size)
+				if err != tt.wantErr {
+					t.Errorf("got error %v, expected %v", err, tt.wantErr)
+				}
+
+				if got != tt.want {
+					t.Errorf("got %q, expected %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestFrameReaderNewline(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+
+	testFraming(t, frameNewline, []framingTest{
+		{name: "empty", in: "", sep: "|", want: ""},
+		{name: "frames", in: "a\nbc\n", sep: "|", want: "a|bc|"},
+		{name: "empty frames", in: "\n\na\n", sep: "|", want: "||a|"},
+		{name: "unterminated final frame", in: "a\nbc", sep: "|", want: "a|bc|"},
+		{name: "nul is data", in: "a\x00b\n", sep: "|", want: "a\x00b|"},
+		{name: "multibyte separator", in: "a\nb\n", sep: "\r\n", want: "a\r\nb\r\n"},
+		{name: "frame longer than the buffer", in: long + "\nb\n", sep: "|", want: long + "|b|"},
+	})
+}
+
+func TestFrameReaderNUL(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+
+	testFraming(t, frameNUL, []framingTest{
+		{name: "empty", in: "", sep: "\n", want: ""},
+		{name: "frames", in: "a\x00bc\x00", sep: "\n", want: "a\nbc\n"},
+		{name: "empty frames", in: "\x00\x00a\x00", sep: "\n", want: "\n\na\n"},
+		{name: "unterminated final frame", in: "a\x00bc", sep: "\n", want: "a\nbc\n"},
+		{name: "newline is data", in: "a\nb\x00", sep: "|", want: "a\nb|"},
+		{name: "frame longer than the buffer", in: long + "\x00b\x00", sep: "\n", want: long + "\nb\n"},
+	})
+}
+
+// lengthPrefixed returns each of the frames, prefixed by its length, as in the length-prefixed framing.
+func lengthPrefixed(frames ...string) string {
+	var b strings.Builder
+
+	for _, frame := range frames {
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(frame)))
+
+		b.Write(hdr[:])
+		b.WriteString(frame)
+	}
+
+	return b.String()
+}
+
+func TestFrameReaderLengthPrefixed(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+
+	testFraming(t, frameLengthPrefixed, []framingTest{
+		{name: "empty", in: "", sep: "\n", want: ""},
+		{name: "frames", in: lengthPrefixed("a", "bc"), sep: "\n", want: "a\nbc\n"},
+		{name: "empty frames", in: lengthPrefixed("", "", "a"), sep: "\n", want: "\n\na\n"},
+		{name: "delimiters are data", in: lengthPrefixed("a\nb\x00c"), sep: "|", want: "a\nb\x00c|"},
+		{name: "long frame", in: lengthPrefixed(long, "b"), sep: "\n", want: long + "\nb\n"},
+		{name: "truncated length", in: lengthPrefixed("a") + "\x00\x00", sep: "\n", want: "a\n", wantErr: errTruncatedFrame},
+		{name: "truncated frame", in: lengthPrefixed("a") + "\x00\x00\x00\x05bc", sep: "\n", want: "a\nbc", wantErr: errTruncatedFrame},
+	})
+}
+
+func TestParseFrameSeparator(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: `\n`, want: "\n"},
+		{in: `\0`, want: "\x00"},
+		{in: `\0\0`, want: "\x00\x00"},
+		{in: `a\0b`, want: "a\x00b"},
+		{in: `\000`, want: "\x00"},
+		{in: `\012`, want: "\n"},
+		{in: `\01`, want: "\x001"},
+		{in: `\x00`, want: "\x00"},
+		{in: `\\0`, want: `\0`},
+		{in: `\\\0`, want: "\\\x00"},
+		{in: `--\r\n`, want: "--\r\n"},
+		{in: `\q`, wantErr: true},
+		{in: `\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFrameSeparator(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseFrameSeparator(%q) = %q, expected an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFrameSeparator(%q): %v", tt.in, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("parseFrameSeparator(%q) = %q, expected %q", tt.in, got, tt.want)
+		}
+	}
+
+	// A separator parsed from \0 frames just as a NUL separator does.
+	sep, err := parseFrameSeparator(`\0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readFrames("a\nbc\n", frameNewline, sep, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "a\x00bc\x00"; got != want {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
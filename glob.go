@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// hasGlobMeta reports whether the given pattern contains any shell-style glob metacharacters.
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// expandGlob expands a shell-style glob pattern into the sorted filenames matching it.
+// A filename without any glob metacharacters is returned as is, whether or not it exists.
+//
+// Local patterns are expanded with filepath.Glob.
+// Other backends are expanded by listing each directory with files.List, and matching names against each element of the pattern.
+// So, only backends that implement files.List can be globbed: SFTP can be globbed in any element,
+// but S3 lists no directories, only the objects under a prefix, so only the last element can be globbed there.
+// HTTP cannot be listed, so it cannot be globbed at all.
+func expandGlob(ctx context.Context, pattern string) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{pattern}, nil
+	}
+
+	if p, isLocal := localPath(pattern); isLocal {
+		return filepath.Glob(p)
+	}
+
+	uri, err := url.Parse(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	elems := strings.Split(strings.TrimPrefix(uri.Path, "/"), "/")
+
+	dirs := []string{""}
+	for i, elem := range elems {
+		last := i == len(elems)-1
+
+		if !hasGlobMeta(elem) {
+			for j := range dirs {
+				dirs[j] += "/" + elem
+			}
+			continue
+		}
+
+		var matched []string
+		for _, dir := range dirs {
+			list := *uri
+			list.Path = dir + "/"
+
+			fi, err := files.List(ctx, list.String())
+			if err != nil {
+				return nil, err
+			}
+
+			for _, info := range fi {
+				name := path.Base(info.Name())
+
+				if ok, err := path.Match(elem, name); err != nil || !ok {
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+
+				if last || info.IsDir() {
+					matched = append(matched, dir+"/"+name)
+				}
+			}
+		}
+
+		dirs = matched
+	}
+
+	filenames := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		match := *uri
+		match.Path = dir
+		filenames = append(filenames, match.String())
+	}
+
+	sort.Strings(filenames)
+
+	return filenames, nil
+}
+
+// expandGlobs expands each of the given patterns, as expandGlob does.
+// A pattern that matches nothing, or cannot be expanded, is reported and skipped, rather than passed on literally.
+func expandGlobs(ctx context.Context, patterns []string) []string {
+	var filenames []string
+
+	for _, pattern := range patterns {
+		matches, err := expandGlob(ctx, pattern)
+		if err != nil {
+			logger.Errorf("%s: glob: %v", pattern, err)
+			continue
+		}
+
+		if len(matches) < 1 {
+			logger.Warningf("%s: no files match", pattern)
+			continue
+		}
+
+		filenames = append(filenames, matches...)
+	}
+
+	return filenames
+}
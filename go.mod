@@ -2,7 +2,13 @@ module github.com/puellanivis/allcat
 
 go 1.21
 
-require github.com/puellanivis/breton v0.2.16
+require (
+	github.com/pkg/sftp v1.13.6
+	github.com/prometheus/client_golang v1.16.0
+	github.com/puellanivis/breton v0.2.16
+	golang.org/x/term v0.18.0
+	golang.org/x/text v0.14.0
+)
 
 require (
 	github.com/aws/aws-sdk-go v1.45.2 // indirect
@@ -12,14 +18,11 @@ require (
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/kr/fs v0.1.0 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
-	github.com/pkg/sftp v1.13.6 // indirect
-	github.com/prometheus/client_golang v1.16.0 // indirect
 	github.com/prometheus/client_model v0.4.0 // indirect
 	github.com/prometheus/common v0.44.0 // indirect
 	github.com/prometheus/procfs v0.11.1 // indirect
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/net v0.23.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 )
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// joinPath joins the given name onto the given directory, which may be either a local path, or a URL.
+func joinPath(dir, name string) string {
+	if p, ok := localPath(dir); ok {
+		return filepath.Join(p, name)
+	}
+
+	uri, err := url.Parse(dir)
+	if err != nil {
+		return filepath.Join(dir, name)
+	}
+
+	uri.Path = path.Join(uri.Path, name)
+	return uri.String()
+}
+
+// hashedOutput writes to a content-addressed file in a directory.
+//
+// As the name is not known until all of the content has been written,
+// the content is written to a temporary file while it is hashed,
+// and then on Close it is renamed to the name derived from the hash.
+// For local directories, the temporary file is created in the directory itself, so the rename is atomic.
+// For other backends, the temporary file is a local spool, which is copied to the destination on Close.
+type hashedOutput struct {
+	ctx context.Context
+
+	spool *os.File
+	h     hash.Hash
+
+	dir, prefix, suffix string
+	isLocal             bool
+
+	// if set, the mode to create a file on another backend with, as set by --output-mode.
+	mode    os.FileMode
+	setMode bool
+
+	// if set, Close removes the temporary file, rather than renaming it.
+	discard bool
+}
+
+// newHashedOutput returns a hashedOutput, which creates its file with the given mode, if setMode is set,
+// or otherwise as any new file would be created, with the umask applied.
+func newHashedOutput(ctx context.Context, dir, algo, prefix, suffix string, mode os.FileMode, setMode bool) (*hashedOutput, error) {
+	newHash, ok := hashes[algo]
+	if !ok {
+		return nil, &url.Error{Op: "hash", URL: algo, Err: files.ErrNotSupported}
+	}
+
+	spoolDir, isLocal := localPath(dir)
+	if !isLocal {
+		spoolDir = ""
+	}
+
+	spool, err := os.CreateTemp(spoolDir, ".allcat-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if isLocal {
+		// A temporary file is created private, but it is renamed into place as the output itself.
+		perm := 0666 &^ umask
+		if setMode {
+			perm = mode
+		}
+
+		if err := spool.Chmod(perm); err != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+			return nil, err
+		}
+	}
+
+	return &hashedOutput{
+		ctx:     ctx,
+		spool:   spool,
+		h:       newHash(),
+		dir:     dir,
+		prefix:  prefix,
+		suffix:  suffix,
+		isLocal: isLocal,
+		mode:    mode,
+		setMode: setMode,
+	}, nil
+}
+
+func (w *hashedOutput) Write(b []byte) (n int, err error) {
+	n, err = w.spool.Write(b)
+	w.h.Write(b[:n])
+	return n, err
+}
+
+// Name returns the name of the content-addressed file, which is only complete once all content has been written.
+func (w *hashedOutput) Name() string {
+	return joinPath(w.dir, w.prefix+hex.EncodeToString(w.h.Sum(nil))+w.suffix)
+}
+
+func (w *hashedOutput) Close() error {
+	target := w.Name()
+
+	if w.discard {
+		err := w.spool.Close()
+		if err2 := os.Remove(w.spool.Name()); err == nil {
+			err = err2
+		}
+		return err
+	}
+
+	if w.isLocal {
+		if err := w.spool.Close(); err != nil {
+			os.Remove(w.spool.Name())
+			return err
+		}
+
+		if err := os.Rename(w.spool.Name(), target); err != nil {
+			os.Remove(w.spool.Name())
+			return err
+		}
+
+		return nil
+	}
+
+	defer func() {
+		if err := w.spool.Close(); err != nil {
+			logger.Error("spool.Close: ", err)
+		}
+
+		if err := os.Remove(w.spool.Name()); err != nil {
+			logger.Error("spool.Remove: ", err)
+		}
+	}()
+
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	out, err := files.Create(w.ctx, target)
+	if err != nil {
+		return err
+	}
+
+	if w.setMode {
+		if _, err := files.WithFileMode(w.mode)(out); err != nil {
+			if !errors.Is(err, files.ErrNotSupported) {
+				out.Close()
+				return err
+			}
+
+			logger.Warningf("%s: --output-mode not supported: %v", out.Name(), err)
+		}
+	}
+
+	if _, err := pooledCopy(w.ctx, out, w.spool); err != nil && err != io.EOF {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
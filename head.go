@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+
+	"github.com/puellanivis/allcat/mutate"
+)
+
+// lineLimiter returns io.EOF once n lines have been read from the underlying io.Reader.
+// As it stops reading at that point, closing the input can then abort a remote transfer early.
+type lineLimiter struct {
+	io.Reader
+	n int
+}
+
+func (r *lineLimiter) Read(b []byte) (n int, err error) {
+	if r.n < 1 {
+		return 0, io.EOF
+	}
+
+	n, err = r.Reader.Read(b)
+
+	// end is how far into b the lines have been counted, up to and including the last line to be read.
+	var end int
+
+	_, stop := mutate.EachLine(b[:n], func(line []byte) error {
+		end += len(line)
+
+		// A line without its newline continues into the next Read.
+		if line[len(line)-1] != '\n' {
+			return nil
+		}
+
+		if r.n--; r.n < 1 {
+			return io.EOF
+		}
+
+		return nil
+	})
+
+	if stop == io.EOF {
+		return end, io.EOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files/httpfiles"
+)
+
+type transportKey struct{}
+
+// withTransport returns a context, in which http-based files are requested through the given http.RoundTripper.
+// It should wrap the transportFrom the context, so that each layer builds on those set before it.
+//
+// The client itself always requests through a statusTransport, outside of every layer.
+func withTransport(ctx context.Context, rt http.RoundTripper) context.Context {
+	ctx = context.WithValue(ctx, transportKey{}, rt)
+
+	return httpfiles.WithClient(ctx, &http.Client{
+		Transport: &statusTransport{
+			RoundTripper: rt,
+		},
+	})
+}
+
+// statusError is a transient error status of an http response, which knows its status code,
+// unlike the error of just the status line that httpfiles reports for it.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return e.status
+}
+
+// StatusCode returns the status code of the response, as the errors of the s3 backend do.
+func (e *statusError) StatusCode() int {
+	return e.code
+}
+
+// statusTransport returns a statusError in place of a response with a transient error status, so that isTransient can tell what it was.
+type statusTransport struct {
+	http.RoundTripper
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if isTransientStatus(resp.StatusCode) {
+		resp.Body.Close()
+
+		return nil, &statusError{
+			code:   resp.StatusCode,
+			status: resp.Status,
+		}
+	}
+
+	return resp, nil
+}
+
+// transportFrom returns the http.RoundTripper set in the context by withTransport, or else the http.DefaultTransport.
+func transportFrom(ctx context.Context) http.RoundTripper {
+	if rt, ok := ctx.Value(transportKey{}).(http.RoundTripper); ok {
+		return rt
+	}
+
+	return http.DefaultTransport
+}
+
+// parseHeaders parses headers each given in the form "Name: Value".
+// Every value given for the same name is kept, in order.
+func parseHeaders(headers []string) (http.Header, error) {
+	h := make(http.Header)
+
+	for _, header := range headers {
+		name, value, found := strings.Cut(header, ":")
+		if !found || name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("bad header %q: expected Name: Value", header)
+		}
+
+		h.Add(name, strings.TrimSpace(value))
+	}
+
+	return h, nil
+}
+
+// sensitiveHeaders are the headers that are not sent on after a redirect to another host,
+// as http.Client itself does when following redirects.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// headerTransport adds its headers to each request made through it.
+// An added header replaces any header of the same name the request already has, such as the User-Agent.
+// After a redirect to another host, the sensitiveHeaders are not added, as with authTransport.
+type headerTransport struct {
+	http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sameHost := sameHostAsOriginal(req)
+
+	req = req.Clone(req.Context())
+
+	for name, values := range t.header {
+		if !sameHost && sensitiveHeaders[name] {
+			continue
+		}
+
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// withHeaders returns a context, in which http-based files are requested with the given headers, as httpfiles.WithUserAgent does for the User-Agent.
+func withHeaders(ctx context.Context, header http.Header) context.Context {
+	return withTransport(ctx, &headerTransport{
+		RoundTripper: transportFrom(ctx),
+		header:       header,
+	})
+}
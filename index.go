@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/puellanivis/allcat/mutate"
+)
+
+// lineIndexer scans the lines written through it, and writes an index entry "lineno: line" for each line matching its pattern.
+//
+// Lines split across Writes are assembled before being matched, so a match is never missed at a chunk boundary.
+// If indexOnly is set, the content itself is not passed on, only the index.
+type lineIndexer struct {
+	io.WriteCloser
+	index     io.Writer
+	indexOnly bool
+
+	re      *regexp.Regexp
+	lineno  int
+	partial []byte
+}
+
+func (w *lineIndexer) match(line []byte) error {
+	w.lineno++
+
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	if !w.re.Match(line) {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w.index, "%d: %s\n", w.lineno, line)
+	return err
+}
+
+func (w *lineIndexer) Write(data []byte) (n int, err error) {
+	if !w.indexOnly {
+		n, err = w.WriteCloser.Write(data)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	n, err = mutate.EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			w.partial = append(w.partial, line...)
+			return nil
+		}
+
+		if len(w.partial) > 0 {
+			line = append(w.partial, line...)
+			w.partial = w.partial[:0]
+		}
+
+		if err := w.match(line); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return len(data), nil
+}
+
+func (w *lineIndexer) Close() error {
+	if len(w.partial) > 0 {
+		partial := w.partial
+		w.partial = nil
+
+		if err := w.match(partial); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
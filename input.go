@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/puellanivis/allcat/extract"
+	_ "github.com/puellanivis/allcat/extract/plugins"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// extractText turns the document read from r into plain text, using the named TextExtractor.
+// If the name is "auto", then the TextExtractor is selected by sniffing the content.
+func extractText(ctx context.Context, r io.Reader, name string) (io.Reader, error) {
+	if name != "auto" {
+		x, ok := extract.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown text extractor: %q", name)
+		}
+
+		return x.Extract(ctx, r)
+	}
+
+	br := bufio.NewReaderSize(r, extract.SniffLen)
+
+	head, err := br.Peek(extract.SniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	x, mimeType, ok := extract.Sniff(head)
+	if !ok {
+		return nil, fmt.Errorf("no text extractor for content type: %s", mimeType)
+	}
+
+	if glog.V(5) {
+		logger.Info("extracting text from: ", mimeType)
+	}
+
+	return x.Extract(ctx, br)
+}
+
+// frameSeparator is the unescaped --frame-separator.
+var frameSeparator []byte
+
+// filteredInput is a filtered input, whose Close releases any decoder used by the filters.
+type filteredInput struct {
+	io.Reader
+	io.Closer
+}
+
+// filterInput wraps the given input with each of the input filters enabled by the flags.
+// The name of the input is used to detect compression formats by their extension.
+//
+// The returned io.ReadCloser must be closed even if reading fails, but its Close does not close the input.
+func filterInput(ctx context.Context, in io.Reader, name string) (io.ReadCloser, error) {
+	dr, err := decompress(ctx, in, name, int(Flags.Decompress))
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = dr
+
+	if Flags.TrimBytesStart > 0 {
+		r = &headSkipper{
+			Reader: r,
+			n:      int64(Flags.TrimBytesStart),
+		}
+	}
+
+	if Flags.Extract != "" {
+		x, err := extractText(ctx, r, Flags.Extract)
+		if err != nil {
+			dr.Close()
+			return nil, err
+		}
+
+		r = x
+	}
+
+	if Flags.Frame != frameNone {
+		r = newFrameReader(r, int(Flags.Frame), frameSeparator)
+	}
+
+	if Flags.Head > 0 {
+		r = &lineLimiter{
+			Reader: r,
+			n:      Flags.Head,
+		}
+	}
+
+	return &filteredInput{
+		Reader: r,
+		Closer: dr,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// spool holds the content of a file being catted out of order, in memory up to limit bytes, and in a temporary file beyond that.
+type spool struct {
+	limit int
+
+	mem  bytes.Buffer
+	file *os.File
+
+	// err is the error, if any, from catting the file into the spool.
+	err error
+}
+
+func (s *spool) Write(b []byte) (n int, err error) {
+	if s.file == nil && s.mem.Len()+len(b) <= s.limit {
+		return s.mem.Write(b)
+	}
+
+	if s.file == nil {
+		f, err := os.CreateTemp("", "allcat-jobs-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+
+		if _, err := s.mem.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.file.Write(b)
+}
+
+// WriteTo writes out everything spooled so far.
+func (s *spool) WriteTo(w io.Writer) (n int64, err error) {
+	if s.file == nil {
+		return s.mem.WriteTo(w)
+	}
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return io.Copy(w, s.file)
+}
+
+// Close releases the spool, removing any temporary file.
+func (s *spool) Close() error {
+	s.mem = bytes.Buffer{}
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	if err2 := os.Remove(s.file.Name()); err == nil {
+		err = err2
+	}
+	s.file = nil
+
+	return err
+}
+
+// CatFilesConcurrently prints the given filenames out to the given io.Writer, fetching and copying up to jobs of them at a time.
+//
+// The content of each file is spooled until all the files before it have been written out,
+// so the output is always in the same order as the filenames.
+// To bound the spooling, a file is not started until it is within jobs of the next file to be written out.
+//
+// If failFast is set, then it stops at the first file that fails, in output order, and returns its error,
+// once whatever was copied of it has been written out.
+// Otherwise, it carries on through every file, and returns the error of the first file that failed, if any.
+//
+// However it returns, it first stops the files still being catted, and releases every spool that was not written out.
+func CatFilesConcurrently(ctx context.Context, out io.Writer, filenames []string, jobs uint, spoolLimit int, failFast bool, opts []files.CopyOption) error {
+	results := make([]chan *spool, len(filenames))
+	for i := range results {
+		results[i] = make(chan *spool, 1)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	defer func() {
+		cancel()
+		wg.Wait()
+
+		// Every worker has stopped, so any spool not yet written out is waiting in its results channel.
+		for _, result := range results {
+			select {
+			case s := <-result:
+				if err := s.Close(); err != nil {
+					logger.Error("spool.Close: ", err)
+				}
+			default:
+			}
+		}
+	}()
+
+	// each file holds a token from when it is started, until it has been written out.
+	tokens := make(chan struct{}, jobs)
+	next := make(chan int)
+
+	go func() {
+		defer close(next)
+
+		for i := range filenames {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := uint(0); w < jobs; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range next {
+				s := &spool{
+					limit: spoolLimit,
+				}
+
+				// CatFile reports its own errors, and whatever was copied before an error is still written out.
+				s.err = CatFile(ctx, s, filenames[i], opts)
+
+				results[i] <- s
+			}
+		}()
+	}
+
+	var firstErr error
+
+	for i, filename := range filenames {
+		var s *spool
+
+		select {
+		case s = <-results[i]:
+		case <-ctx.Done():
+			logger.Error(ctx.Err())
+			return ctx.Err()
+		}
+
+		_, err := s.WriteTo(out)
+
+		if err := s.Close(); err != nil {
+			logger.Error("spool.Close: ", err)
+		}
+
+		<-tokens
+
+		if err != nil {
+			logger.Errorf("%s: %v", filename, err)
+			return err
+		}
+
+		// A file truncated by --max-bytes is not a failure.
+		if s.err != nil && s.err != errTruncated {
+			if failFast {
+				return s.err
+			}
+
+			if firstErr == nil {
+				firstErr = s.err
+			}
+		}
+	}
+
+	return firstErr
+}
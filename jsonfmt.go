@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonIndent is the indentation used by --json-pretty.
+const jsonIndent = "  "
+
+// jsonReformatter re-encodes a stream of JSON values, either indented, or with indent empty, compacted.
+//
+// The stream may be a single value, or many, as in JSONL, and each top-level value is written out followed by a newline,
+// so that compacted JSONL stays one value per line.
+// A top-level array is streamed an element at a time, so that only the largest element is held in memory, rather than the whole array.
+type jsonReformatter struct {
+	dec    *json.Decoder
+	out    io.Writer
+	indent string
+
+	buf bytes.Buffer
+}
+
+// reformatJSON returns an io.Reader of the given JSON stream reformatted.
+// Invalid JSON stops the stream with an error saying where it is, after only the values before it.
+func reformatJSON(r io.Reader, indent string) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	f := &jsonReformatter{
+		dec:    dec,
+		out:    pw,
+		indent: indent,
+	}
+
+	go func() {
+		pw.CloseWithError(f.run())
+	}()
+
+	return pr
+}
+
+func (f *jsonReformatter) errorf(err error) error {
+	return fmt.Errorf("invalid JSON value starting at byte %d: %w", f.dec.InputOffset(), err)
+}
+
+// format appends the given value to the buffer, reformatted, with each line after the first indented by prefix.
+func (f *jsonReformatter) format(raw json.RawMessage, prefix string) error {
+	if f.indent == "" {
+		return json.Compact(&f.buf, raw)
+	}
+
+	return json.Indent(&f.buf, raw, prefix, f.indent)
+}
+
+func (f *jsonReformatter) flush() error {
+	_, err := f.out.Write(f.buf.Bytes())
+	f.buf.Reset()
+	return err
+}
+
+func (f *jsonReformatter) run() error {
+	for {
+		if !f.dec.More() {
+			// More returns false on both the end of the stream, and a stray closing delimiter.
+			if _, err := f.dec.Token(); err != io.EOF {
+				if err == nil {
+					err = fmt.Errorf("unexpected closing delimiter")
+				}
+				return f.errorf(err)
+			}
+			return nil
+		}
+
+		var err error
+		if f.peek() == '[' {
+			err = f.array()
+		} else {
+			err = f.value()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// peek returns the first non-whitespace byte of the next value, without consuming it.
+func (f *jsonReformatter) peek() byte {
+	b, _ := io.ReadAll(io.LimitReader(f.dec.Buffered(), 1<<10))
+	for _, c := range b {
+		if !isSpace(c) {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func (f *jsonReformatter) value() error {
+	var raw json.RawMessage
+	if err := f.dec.Decode(&raw); err != nil {
+		return f.errorf(err)
+	}
+
+	if err := f.format(raw, ""); err != nil {
+		return f.errorf(err)
+	}
+	f.buf.WriteByte('\n')
+
+	return f.flush()
+}
+
+func (f *jsonReformatter) array() error {
+	if _, err := f.dec.Token(); err != nil {
+		return f.errorf(err)
+	}
+
+	f.buf.WriteByte('[')
+
+	for i := 0; f.dec.More(); i++ {
+		var raw json.RawMessage
+		if err := f.dec.Decode(&raw); err != nil {
+			return f.errorf(err)
+		}
+
+		if i > 0 {
+			f.buf.WriteByte(',')
+		}
+
+		if f.indent != "" {
+			f.buf.WriteString("\n" + f.indent)
+		}
+
+		if err := f.format(raw, f.indent); err != nil {
+			return f.errorf(err)
+		}
+
+		if err := f.flush(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := f.dec.Token(); err != nil {
+		return f.errorf(err)
+	}
+
+	if f.indent != "" && f.buf.Len() == 0 {
+		f.buf.WriteByte('\n')
+	}
+	f.buf.WriteString("]\n")
+
+	return f.flush()
+}
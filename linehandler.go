@@ -1,131 +1,227 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/puellanivis/allcat/mutate"
 )
 
-func splitLines(data []byte) [][]byte {
-	var fields [][]byte
-	var last int
-	for i := 0; i < len(data); i++ {
-		if data[i] == '\n' {
-			fields = append(fields, data[last:i+1:i+1])
-			last = i + 1
-		}
-	}
-	if last != len(data) {
-		fields = append(fields, data[last:])
-	}
-	return fields
-}
+// Line number padding.
+const (
+	numberPadSpace = iota
+	numberPadZero
+)
 
-type lineNumberer struct {
+// numberFormat is the format given by --number-format, or built from --number-width, --number-pad, and --number-separator.
+// It always has exactly one integer verb.
+var numberFormat = mutate.DefaultNumberFormat
+
+// lineMatcher passes on only the lines matching its pattern, with before and after lines of context around them, like grep.
+// Non-adjacent hunks of context are separated by a "--" line.
+//
+// If re is nil, then every line matches, and if exclude is set, then lines matching it do not match, like grep -v.
+//
+// Since a line can only be matched once it is complete, each line is held until its newline is seen.
+type lineMatcher struct {
 	io.WriteCloser
-	lineno   int
-	suppress bool
+	re, exclude   *regexp.Regexp
+	before, after int
+
+	lineno      int
+	lastEmitted int
+	afterLeft   int
+
+	// ring holds up to before of the most recent lines not yet passed on.
+	ring [][]byte
+	cur  []byte
 }
 
-func (w *lineNumberer) Write(data []byte) (n int, err error) {
-	lines := splitLines(data)
+func (w *lineMatcher) emit(line []byte) error {
+	_, err := w.WriteCloser.Write(line)
+	return err
+}
 
-	for _, line := range lines {
-		if !w.suppress {
-			w.lineno++
-			if _, err := fmt.Fprintf(w.WriteCloser, "%6d\t", w.lineno); err != nil {
-				return n, err
+func (w *lineMatcher) match(line []byte) bool {
+	if w.re != nil && !w.re.Match(line) {
+		return false
+	}
+
+	return w.exclude == nil || !w.exclude.Match(line)
+}
+
+func (w *lineMatcher) matchLine(line []byte) error {
+	w.lineno++
+
+	if !w.match(bytes.TrimSuffix(line, []byte{'\n'})) {
+		if w.afterLeft > 0 {
+			w.afterLeft--
+			w.lastEmitted = w.lineno
+			return w.emit(line)
+		}
+
+		if w.before > 0 {
+			if len(w.ring) >= w.before {
+				w.ring = w.ring[1:]
 			}
+			w.ring = append(w.ring, append([]byte(nil), line...))
 		}
 
-		written, err := w.WriteCloser.Write(line)
-		n += written
-		if err != nil {
-			return n, err
+		return nil
+	}
+
+	first := w.lineno - len(w.ring)
+	if (w.before > 0 || w.after > 0) && w.lastEmitted > 0 && first > w.lastEmitted+1 {
+		if err := w.emit([]byte("--\n")); err != nil {
+			return err
 		}
+	}
 
-		w.suppress = len(line) < 1 || line[len(line)-1] != '\n'
+	for _, prev := range w.ring {
+		if err := w.emit(prev); err != nil {
+			return err
+		}
 	}
+	w.ring = w.ring[:0]
 
-	return n, nil
-}
+	w.lastEmitted = w.lineno
+	w.afterLeft = w.after
 
-type nonblankLineNumberer struct {
-	io.WriteCloser
-	lineno   int
-	suppress bool
+	return w.emit(line)
 }
 
-func (w *nonblankLineNumberer) Write(data []byte) (n int, err error) {
-	lines := splitLines(data)
+func (w *lineMatcher) Write(data []byte) (n int, err error) {
+	n, err = mutate.EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			w.cur = append(w.cur, line...)
+			return nil
+		}
 
-	for _, line := range lines {
-		if len(line) < 1 || line[0] == '\n' {
-			w.suppress = true
+		if len(w.cur) > 0 {
+			line = append(w.cur, line...)
+			w.cur = w.cur[:0]
 		}
 
-		if !w.suppress {
-			w.lineno++
-			if _, err := fmt.Fprintf(w.WriteCloser, "%6d\t", w.lineno); err != nil {
-				return n, err
-			}
+		return w.matchLine(line)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return len(data), nil
+}
+
+func (w *lineMatcher) Close() error {
+	if len(w.cur) > 0 {
+		cur := w.cur
+		w.cur = nil
+
+		if err := w.matchLine(cur); err != nil {
+			return err
 		}
+	}
+
+	return w.WriteCloser.Close()
+}
 
-		written, err := w.WriteCloser.Write(line)
-		n += written
-		if err != nil {
-			return n, err
+// lineSpan is a range of line numbers, from start through end inclusive, counting from 1.
+// If end is zero, then the span extends to the end of the input.
+type lineSpan struct {
+	start, end int
+}
+
+// parseLineSpan parses a line span given as "START:END", like sed's "START,ENDp".
+// Either may be omitted: START defaults to the first line, and END to the last.
+func parseLineSpan(s string) (*lineSpan, error) {
+	from, to, found := strings.Cut(s, ":")
+	if !found {
+		return nil, fmt.Errorf("bad line range %q: expected START:END", s)
+	}
+
+	span := &lineSpan{
+		start: 1,
+	}
+
+	if from != "" {
+		n, err := strconv.Atoi(from)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad line range %q: bad start", s)
 		}
+		span.start = n
+	}
 
-		w.suppress = len(line) < 1 || line[len(line)-1] != '\n'
+	if to != "" {
+		n, err := strconv.Atoi(to)
+		if err != nil || n < span.start {
+			return nil, fmt.Errorf("bad line range %q: bad end", s)
+		}
+		span.end = n
 	}
 
-	return n, nil
+	return span, nil
 }
 
-type blankSqueezer struct {
-	io.WriteCloser
-	lastWasBlank bool
+// lineRanger passes on only the lines within its span.
+//
+// A line split across Writes is passed on piecewise, as whether it is in the span is known from its start.
+// Once the end of the span has been passed on, done is called, so that the copy can stop reading,
+// and everything written after that is discarded.
+type lineRanger struct {
+	io.Writer
+	lineSpan
+	done func()
+
+	lineno  int
+	midline bool
+	past    bool
 }
 
-func (w *blankSqueezer) Write(data []byte) (n int, err error) {
-	lines := splitLines(data)
+func (w *lineRanger) Write(data []byte) (n int, err error) {
+	if w.past {
+		return len(data), nil
+	}
 
-	for _, line := range lines {
-		if len(line) < 1 {
-			continue
+	n, err = mutate.EachLine(data, func(line []byte) error {
+		if w.past {
+			return nil
 		}
 
-		if line[len(line)-1] != '\n' {
-			written, err := w.WriteCloser.Write(line)
-			n += written
-			if err != nil {
-				return n, err
-			}
-			continue
+		if !w.midline {
+			w.lineno++
 		}
+		w.midline = line[len(line)-1] != '\n'
 
-		if line[0] == '\n' {
-			if w.lastWasBlank {
-				n++ // we “wrote” this value from the input.
-				continue
-			}
+		if w.lineno < w.start {
+			return nil
+		}
 
-			written, err := w.WriteCloser.Write(line)
-			n += written
-			if err != nil {
-				return n, err
-			}
-			w.lastWasBlank = true
-			continue
+		if _, err := w.Writer.Write(line); err != nil {
+			return err
 		}
-		w.lastWasBlank = false
 
-		written, err := w.WriteCloser.Write(line)
-		n += written
-		if err != nil {
-			return n, err
+		if w.end > 0 && w.lineno >= w.end && !w.midline {
+			w.past = true
+			if w.done != nil {
+				w.done()
+			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return n, err
 	}
 
-	return n, nil
+	return len(data), nil
 }
+
+// Line ending normalizations.
+const (
+	lineEndingKeep = iota
+	lineEndingLF
+	lineEndingCRLF
+)
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns the lines "1" through "n", each with its newline.
+func numberedLines(n int) string {
+	var b strings.Builder
+
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+
+	return b.String()
+}
+
+func TestLineMatcherContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		pattern       string
+		exclude       string
+		before, after int
+		in            string
+		want          string
+	}{
+		{
+			name:    "no context",
+			pattern: "^(2|8)$",
+			in:      numberedLines(10),
+			want:    "2\n8\n",
+		},
+		{
+			name:    "single match",
+			pattern: "^5$",
+			before:  1,
+			after:   1,
+			in:      numberedLines(10),
+			want:    "4\n5\n6\n",
+		},
+		{
+			name:    "separate groups",
+			pattern: "^(2|8)$",
+			before:  1,
+			after:   1,
+			in:      numberedLines(10),
+			want:    "1\n2\n3\n--\n7\n8\n9\n",
+		},
+		{
+			name:    "gap of one line",
+			pattern: "^(2|7)$",
+			before:  1,
+			after:   1,
+			in:      numberedLines(10),
+			want:    "1\n2\n3\n--\n6\n7\n8\n",
+		},
+		{
+			name:    "touching windows",
+			pattern: "^(2|6)$",
+			before:  2,
+			after:   1,
+			in:      numberedLines(10),
+			want:    "1\n2\n3\n4\n5\n6\n7\n",
+		},
+		{
+			name:    "overlapping windows",
+			pattern: "^(3|5)$",
+			before:  2,
+			after:   2,
+			in:      numberedLines(10),
+			want:    "1\n2\n3\n4\n5\n6\n7\n",
+		},
+		{
+			name:    "match within after context",
+			pattern: "^(2|3)$",
+			after:   1,
+			in:      numberedLines(10),
+			want:    "2\n3\n4\n",
+		},
+		{
+			name:    "only after context",
+			pattern: "^(2|8)$",
+			after:   1,
+			in:      numberedLines(10),
+			want:    "2\n3\n--\n8\n9\n",
+		},
+		{
+			name:    "only before context",
+			pattern: "^(2|8)$",
+			before:  1,
+			in:      numberedLines(10),
+			want:    "1\n2\n--\n7\n8\n",
+		},
+		{
+			name:    "before context at start",
+			pattern: "^1$",
+			before:  3,
+			after:   1,
+			in:      numberedLines(5),
+			want:    "1\n2\n",
+		},
+		{
+			name:    "after context at end",
+			pattern: "^5$",
+			after:   3,
+			in:      numberedLines(5),
+			want:    "5\n",
+		},
+		{
+			name:    "exclude",
+			exclude: "^[2-9]$",
+			before:  0,
+			after:   0,
+			in:      numberedLines(10),
+			want:    "1\n10\n",
+		},
+		{
+			name:    "no final newline",
+			pattern: "b",
+			in:      "a\nb",
+			want:    "b",
+		},
+	}
+
+	for _, tt := range tests {
+		var re, exclude *regexp.Regexp
+		if tt.pattern != "" {
+			re = regexp.MustCompile(tt.pattern)
+		}
+		if tt.exclude != "" {
+			exclude = regexp.MustCompile(tt.exclude)
+		}
+
+		for _, size := range splitSizes {
+			t.Run(fmt.Sprintf("%s/split=%d", tt.name, size), func(t *testing.T) {
+				out := new(bufferCloser)
+
+				writeSplit(t, &lineMatcher{
+					WriteCloser: out,
+					re:          re,
+					exclude:     exclude,
+					before:      tt.before,
+					after:       tt.after,
+				}, []byte(tt.in), size)
+
+				if got := out.String(); got != tt.want {
+					t.Errorf("got %q, expected %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
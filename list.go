@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/puellanivis/breton/lib/display/tables"
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// Listing output formats.
+const (
+	listTable = iota
+	listJSON
+	listJSONL
+)
+
+// listEntry is a single entry of a listing, as rendered by the json and jsonl formats.
+type listEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Mode    string `json:"mode"`
+	ModTime string `json:"modtime"`
+	Xattrs  string `json:"xattrs,omitempty"`
+
+	// Stat holds the extended metadata shown by --stat, by column name.
+	Stat map[string]string `json:"stat,omitempty"`
+}
+
+func newListEntry(info os.FileInfo) *listEntry {
+	return &listEntry{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime().Format(time.RFC3339),
+	}
+}
+
+// writeJSONListing writes the entries of a listing to the given io.Writer,
+// either as a single JSON array, or with lines set, as one JSON object per line.
+// Any of the given statFields that an entry has a value for are included in its stat object.
+func writeJSONListing(out io.Writer, fi []os.FileInfo, lines bool, xattrs func(os.FileInfo) string, fields []statField) error {
+	entries := make([]*listEntry, 0, len(fi))
+	for _, info := range fi {
+		entry := newListEntry(info)
+		if xattrs != nil {
+			if x := xattrs(info); x != "-" {
+				entry.Xattrs = x
+			}
+		}
+
+		for _, field := range fields {
+			if v := field.get(info); v != "" {
+				if entry.Stat == nil {
+					entry.Stat = make(map[string]string)
+				}
+				entry.Stat[field.name] = v
+			}
+		}
+
+		if !lines {
+			entries = append(entries, entry)
+			continue
+		}
+
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if _, err := out.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if lines {
+		return nil
+	}
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
+
+// humanSize formats a size in powers of 1024, like ls -h: 1.5K, 2.3M, 41G.
+func humanSize(n int64) string {
+	const units = "KMGTPE"
+
+	if n < 1024 {
+		return strconv.FormatInt(n, 10)
+	}
+
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+
+	if f < 10 {
+		return fmt.Sprintf("%.1f%c", f, units[i])
+	}
+
+	return fmt.Sprintf("%.0f%c", f, units[i])
+}
+
+// parseHumanSize parses a size given in bytes, or with a suffix in powers of 1024, as humanSize formats them: 1.5K, 100M, 4G.
+func parseHumanSize(s string) (int64, error) {
+	const units = "KMGTPE"
+
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	scale := 1.0
+
+	if l := len(num); l > 0 {
+		if i := strings.IndexByte(units, num[l-1]); i >= 0 {
+			num = num[:l-1]
+
+			for ; i >= 0; i-- {
+				scale *= 1024
+			}
+		}
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("bad size %q: expected bytes, or a number with a suffix like 1.5K, 100M, or 4G", s)
+	}
+
+	return int64(f * scale), nil
+}
+
+// parseListTime parses a time given as RFC3339, as a date like 2024-01-01, or as a duration before now, like 36h, 7d, or 2w.
+func parseListTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+
+	d, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q: expected RFC3339, a date like 2024-01-01, or an age like 36h, 7d, or 2w", s)
+	}
+
+	return now.Add(-d), nil
+}
+
+// parseAge parses a duration as time.ParseDuration does, but also allows a whole number of days, or weeks, like 7d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 31)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// listBounds are the size and time bounds of the entries to include in a listing, per --min-size, --max-size, --newer-than, and --older-than.
+// A negative size, or a zero time, is no bound.
+type listBounds struct {
+	minSize, maxSize     int64
+	newerThan, olderThan time.Time
+}
+
+// listLimits are the bounds of the entries to include in a listing, if any are set.
+var listLimits *listBounds
+
+// includes reports whether the given entry is within the bounds.
+func (b *listBounds) includes(info os.FileInfo) bool {
+	switch {
+	case b.minSize >= 0 && info.Size() < b.minSize:
+	case b.maxSize >= 0 && info.Size() > b.maxSize:
+	case !b.newerThan.IsZero() && !info.ModTime().After(b.newerThan):
+	case !b.olderThan.IsZero() && !info.ModTime().Before(b.olderThan):
+	default:
+		return true
+	}
+
+	return false
+}
+
+// filterBounds returns the entries of a listing that are within the given bounds.
+func filterBounds(fi []os.FileInfo, b *listBounds) []os.FileInfo {
+	filtered := fi[:0]
+	for _, info := range fi {
+		if b.includes(info) {
+			filtered = append(filtered, info)
+		}
+	}
+
+	return filtered
+}
+
+// Listing sort orders.
+const (
+	listSortName = iota
+	listSortSize
+	listSortTime
+)
+
+// listOrders are the orderings of a listing, selectable by --sort.
+var listOrders = []func(a, b os.FileInfo) bool{
+	listSortName: func(a, b os.FileInfo) bool {
+		return a.Name() < b.Name()
+	},
+	listSortSize: func(a, b os.FileInfo) bool {
+		return a.Size() < b.Size()
+	},
+	listSortTime: func(a, b os.FileInfo) bool {
+		return a.ModTime().Before(b.ModTime())
+	},
+}
+
+// sizeColumn is the index of the size column of a listing.
+const sizeColumn = 1
+
+// writeNames0 writes the path of each entry of a listing of dirname, each terminated by a NUL, like find -print0,
+// so that any filename can be safely passed on to xargs -0, or back into allcat --files --null.
+func writeNames0(out io.Writer, dirname string, fi []os.FileInfo) error {
+	dir := strings.TrimSuffix(dirname, "/") + "/"
+
+	var b []byte
+	for _, info := range fi {
+		b = append(b[:0], dir...)
+		b = append(b, info.Name()...)
+		b = append(b, 0)
+
+		if _, err := out.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listColumns renders the columns of a single entry of a listing.
+func listColumns(info os.FileInfo) []string {
+	size := strconv.FormatInt(info.Size(), 10)
+	if Flags.Human {
+		size = humanSize(info.Size())
+	}
+
+	return []string{
+		info.Mode().String(),
+		size,
+		info.ModTime().Format(time.RFC3339),
+		info.Name(),
+	}
+}
+
+// localPath returns the local filesystem path of the given name, if it refers to a local file.
+func localPath(name string) (string, bool) {
+	if filepath.IsAbs(name) {
+		return name, true
+	}
+
+	uri, err := url.Parse(name)
+	if err != nil {
+		return name, true
+	}
+
+	switch uri.Scheme {
+	case "":
+		return name, true
+	case "file":
+		if uri.Path != "" {
+			return uri.Path, true
+		}
+		return uri.Opaque, true
+	}
+
+	return "", false
+}
+
+// xattrColumn renders the extended attributes of the given local path as a single column.
+// Where extended attributes are unavailable, it degrades to "-".
+func xattrColumn(path string, withValues bool) string {
+	names, err := listXattr(path)
+	if err != nil {
+		if glog.V(5) {
+			logger.Infof("%s: xattr: %v", path, err)
+		}
+	}
+
+	if len(names) < 1 {
+		return "-"
+	}
+
+	if !withValues {
+		return strings.Join(names, ",")
+	}
+
+	attrs := make([]string, 0, len(names))
+	for _, name := range names {
+		val, err := getXattr(path, name)
+		if err != nil {
+			attrs = append(attrs, name)
+			continue
+		}
+
+		attrs = append(attrs, name+"="+strconv.Quote(string(val)))
+	}
+
+	return strings.Join(attrs, ",")
+}
+
+// writeListing writes the rows of a listing to the given io.Writer.
+//
+// Rather than building up a whole tables.Table, the column widths are computed in a first pass,
+// and each row is then rendered again, and written out one at a time.
+// This saves holding every rendered row at once, but the backend listing, and any sort of it, still holds the whole []os.FileInfo.
+// The layout is the same as tables.Empty: every column but the last is padded, and separated by a single space.
+// The column at the index rightAlign, if any, is padded on the left instead, so that its values line up on the right.
+func writeListing(out io.Writer, fi []os.FileInfo, render func(os.FileInfo) []string, rightAlign int) error {
+	width := tables.Empty.WidthFunc
+	if width == nil {
+		width = func(s string) int {
+			return len(s)
+		}
+	}
+
+	var widths []int
+	for _, info := range fi {
+		for i, col := range render(info) {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+
+			if l := width(col); widths[i] < l {
+				widths[i] = l
+			}
+		}
+	}
+
+	line := new(bytes.Buffer)
+	for _, info := range fi {
+		line.Reset()
+
+		cols := render(info)
+		for i, col := range cols {
+			if i > 0 {
+				line.WriteByte(' ')
+			}
+
+			pad := widths[i] - width(col)
+
+			if i == rightAlign && pad > 0 {
+				line.WriteString(strings.Repeat(" ", pad))
+			}
+
+			line.WriteString(col)
+
+			if i != rightAlign && i < len(cols)-1 && pad > 0 {
+				line.WriteString(strings.Repeat(" ", pad))
+			}
+		}
+
+		line.WriteByte('\n')
+
+		if _, err := out.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matchAny reports whether the given name matches any of the given glob patterns.
+// The patterns have already been checked to be well-formed, so a match error cannot occur.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterListing returns the entries of a listing whose base name matches any of the name patterns,
+// or any of the iname patterns regardless of case, and matches none of the exclude patterns.
+// If there are no name or iname patterns, then every entry is included, unless it is excluded.
+//
+// As with find -name, only the base name is matched, even in a --recursive listing.
+func filterListing(fi []os.FileInfo, names, inames, excludes []string) []os.FileInfo {
+	lowered := make([]string, len(inames))
+	for i, pattern := range inames {
+		lowered[i] = strings.ToLower(pattern)
+	}
+
+	filtered := fi[:0]
+	for _, info := range fi {
+		base := path.Base(info.Name())
+
+		included := len(names) == 0 && len(inames) == 0
+		if matchAny(names, base) || matchAny(lowered, strings.ToLower(base)) {
+			included = true
+		}
+
+		if included && !matchAny(excludes, base) {
+			filtered = append(filtered, info)
+		}
+	}
+
+	return filtered
+}
+
+// prefixedInfo is an entry of a recursive listing, named by its path relative to the listed directory.
+type prefixedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi *prefixedInfo) Name() string {
+	return fi.name
+}
+
+// listTree expands the given listing of dirname with the entries of each of its subdirectories, recursively,
+// down to Flags.MaxDepth levels, if set.
+//
+// Symlinks are not followed, as they are not listed as directories,
+// so a symlink loop on a local filesystem can only arise from a directory being reached twice,
+// which is guarded against by tracking the resolved path of each local directory walked.
+// A remote backend with a flat namespace, like S3, has no such loops, and simply expands.
+func listTree(ctx context.Context, dirname string, fi []os.FileInfo) []os.FileInfo {
+	seen := make(map[string]bool)
+
+	var walk func(dirname, prefix string, fi []os.FileInfo, depth int) []os.FileInfo
+	walk = func(dirname, prefix string, fi []os.FileInfo, depth int) []os.FileInfo {
+		if dir, isLocal := localPath(dirname); isLocal {
+			if real, err := filepath.EvalSymlinks(dir); err == nil {
+				if seen[real] {
+					logger.Warningf("%s: directory loop detected, not descending", dirname)
+					return nil
+				}
+				seen[real] = true
+			}
+		}
+
+		var tree []os.FileInfo
+		for _, info := range fi {
+			name := prefix + info.Name()
+			if prefix != "" {
+				info = &prefixedInfo{
+					FileInfo: info,
+					name:     name,
+				}
+			}
+
+			tree = append(tree, info)
+
+			if !info.IsDir() || (Flags.MaxDepth > 0 && depth >= Flags.MaxDepth) {
+				continue
+			}
+
+			subdir := strings.TrimSuffix(dirname, "/") + "/" + path.Base(name)
+
+			sub, err := files.List(ctx, subdir)
+			if err != nil {
+				logger.Errorf("files.List: %s: %v", subdir, err)
+				continue
+			}
+
+			tree = append(tree, walk(subdir, name+"/", sub, depth+1)...)
+		}
+
+		return tree
+	}
+
+	return walk(dirname, "", fi, 1)
+}
+
+// ListFile lists the given dirname to the given io.Writer.
+// A listing counts towards the files and bytes metrics, as a file whose content is the listing.
+//
+// The backend returns the whole directory listing at once,
+// so sorting is done in place on that slice, and needs no further buffering.
+func ListFile(ctx context.Context, out io.Writer, dirname string) (err error) {
+	counted := &countingWriter{
+		Writer: out,
+	}
+	out = counted
+
+	defer func() {
+		scheme := labelScheme.WithValue(schemeOf(dirname))
+
+		if err != nil {
+			filesFailed.WithLabels(scheme).Inc()
+			return
+		}
+
+		filesProcessed.WithLabels(scheme).Inc()
+		bytesCopied.Add(float64(counted.n))
+	}()
+
+	fi, err := files.List(ctx, dirname)
+	if err != nil {
+		logger.Error("files.List: ", err)
+		return err
+	}
+
+	if Flags.Recursive {
+		fi = listTree(ctx, dirname, fi)
+	}
+
+	if len(Flags.Name) > 0 || len(Flags.IName) > 0 || len(Flags.Exclude) > 0 {
+		fi = filterListing(fi, Flags.Name, Flags.IName, Flags.Exclude)
+	}
+
+	if listLimits != nil {
+		fi = filterBounds(fi, listLimits)
+	}
+
+	less := listOrders[Flags.Sort]
+	if Flags.ReverseSort {
+		less = func(a, b os.FileInfo) bool {
+			return listOrders[Flags.Sort](b, a)
+		}
+	}
+
+	// A stable sort, so that ties keep the order that the backend listed them in.
+	sort.SliceStable(fi, func(i, j int) bool {
+		return less(fi[i], fi[j])
+	})
+
+	render := listColumns
+
+	var xattrs func(os.FileInfo) string
+
+	if Flags.ShowXattr {
+		dir, isLocal := localPath(dirname)
+
+		xattrs = func(info os.FileInfo) string {
+			if !isLocal {
+				return "-"
+			}
+
+			return xattrColumn(filepath.Join(dir, info.Name()), Flags.ShowXattrValues)
+		}
+
+		render = func(info os.FileInfo) []string {
+			cols := listColumns(info)
+			xattrs := xattrs(info)
+
+			// keep the name as the last column.
+			last := len(cols) - 1
+			return append(cols[:last:last], xattrs, cols[last])
+		}
+	}
+
+	var fields []statField
+	if Flags.Stat {
+		fields = statColumns(fi)
+	}
+
+	if len(fields) > 0 {
+		withoutStat := render
+
+		render = func(info os.FileInfo) []string {
+			cols := withoutStat(info)
+
+			// keep the name as the last column.
+			last := len(cols) - 1
+			return append(append(cols[:last:last], statValues(info, fields)...), cols[last])
+		}
+	}
+
+	if Flags.Print0 {
+		if err := writeNames0(out, dirname, fi); err != nil {
+			logger.Error("list: ", err)
+			return err
+		}
+		return nil
+	}
+
+	if format := int(Flags.ListFormat); format != listTable {
+		if err := writeJSONListing(out, fi, format == listJSONL, xattrs, fields); err != nil {
+			logger.Error("list: ", err)
+			return err
+		}
+		return nil
+	}
+
+	// Raw sizes stay left-aligned, as they always have been, for scripts that parse the table.
+	rightAlign := -1
+	if Flags.Human {
+		rightAlign = sizeColumn
+	}
+
+	if err := writeListing(out, fi, render, rightAlign); err != nil {
+		logger.Error("list: ", err)
+		return err
+	}
+
+	if Flags.Total {
+		if _, err := io.WriteString(out, listTotal(fi)); err != nil {
+			logger.Error("list: ", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listTotal renders the summary line of a listing: how many files it has, and their total size.
+// Directories are neither counted nor sized, as their sizes are not of their contents.
+func listTotal(fi []os.FileInfo) string {
+	var n, total int64
+	for _, info := range fi {
+		if info.IsDir() {
+			continue
+		}
+
+		n++
+		total += info.Size()
+	}
+
+	files := "files"
+	if n == 1 {
+		files = "file"
+	}
+
+	if total < 1024 {
+		return fmt.Sprintf("%d %s, %d bytes\n", n, files, total)
+	}
+
+	return fmt.Sprintf("%d %s, %d bytes (%s)\n", n, files, total, humanSize(total))
+}
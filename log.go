@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// Formats of --log-format.
+const (
+	logFormatText = iota
+	logFormatJSON
+)
+
+// logSink is where the informational messages, warnings, and errors of allcat are logged.
+// Whether a message is logged at all is still decided by glog, as with glog.V.
+type logSink interface {
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warning(args ...interface{})
+	Warningf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	// Fatal and Fatalf log, and then exit, in the same way as glog.Fatal.
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// logger is the logSink for --log-format, which is glog, unless set otherwise.
+var logger logSink = glogSink{}
+
+// glogSink logs through glog, in its usual text format.
+// Each message is logged at the depth of its caller, so that glog reports the file and line that logged it.
+type glogSink struct{}
+
+func (glogSink) Info(args ...interface{}) {
+	glog.InfoDepth(1, args...)
+}
+
+func (glogSink) Infof(format string, args ...interface{}) {
+	glog.InfoDepth(1, fmt.Sprintf(format, args...))
+}
+
+func (glogSink) Warning(args ...interface{}) {
+	glog.WarningDepth(1, args...)
+}
+
+func (glogSink) Warningf(format string, args ...interface{}) {
+	glog.WarningDepth(1, fmt.Sprintf(format, args...))
+}
+
+func (glogSink) Error(args ...interface{}) {
+	glog.ErrorDepth(1, args...)
+}
+
+func (glogSink) Errorf(format string, args ...interface{}) {
+	glog.ErrorDepth(1, fmt.Sprintf(format, args...))
+}
+
+func (glogSink) Fatal(args ...interface{}) {
+	glog.FatalDepth(1, args...)
+}
+
+func (glogSink) Fatalf(format string, args ...interface{}) {
+	glog.FatalDepth(1, fmt.Sprintf(format, args...))
+}
+
+// logEntry is a single line of --log-format=json.
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Caller  string `json:"caller,omitempty"`
+	Message string `json:"msg"`
+}
+
+// jsonSink logs each message as a single line of JSON, for log aggregators.
+type jsonSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONSink(w io.Writer) *jsonSink {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return &jsonSink{
+		enc: enc,
+	}
+}
+
+// log writes out a single entry at the given level, reporting the caller of whichever method of jsonSink called it.
+func (s *jsonSink) log(level, msg string) {
+	e := &logEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Level:   level,
+		Message: strings.TrimSuffix(msg, "\n"),
+	}
+
+	if _, file, line, ok := runtime.Caller(2); ok {
+		e.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// There is nowhere left to report an error from writing a log, so it is dropped, as glog does.
+	_ = s.enc.Encode(e)
+}
+
+func (s *jsonSink) Info(args ...interface{}) {
+	s.log("info", fmt.Sprint(args...))
+}
+
+func (s *jsonSink) Infof(format string, args ...interface{}) {
+	s.log("info", fmt.Sprintf(format, args...))
+}
+
+func (s *jsonSink) Warning(args ...interface{}) {
+	s.log("warning", fmt.Sprint(args...))
+}
+
+func (s *jsonSink) Warningf(format string, args ...interface{}) {
+	s.log("warning", fmt.Sprintf(format, args...))
+}
+
+func (s *jsonSink) Error(args ...interface{}) {
+	s.log("error", fmt.Sprint(args...))
+}
+
+func (s *jsonSink) Errorf(format string, args ...interface{}) {
+	s.log("error", fmt.Sprintf(format, args...))
+}
+
+func (s *jsonSink) Fatal(args ...interface{}) {
+	s.log("fatal", fmt.Sprint(args...))
+	glog.Flush()
+	os.Exit(255)
+}
+
+func (s *jsonSink) Fatalf(format string, args ...interface{}) {
+	s.log("fatal", fmt.Sprintf(format, args...))
+	glog.Flush()
+	os.Exit(255)
+}
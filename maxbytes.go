@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// errTruncated is returned by CatFile when an input was cut short by --max-bytes.
+var errTruncated = errors.New("truncated at --max-bytes")
+
+// byteCapper returns io.EOF once n bytes have been read from the underlying io.Reader.
+//
+// At that point, it reads ahead a single byte to tell whether the input was actually longer than the cap.
+// If it was, then hit is set, and done is called, so that the remote transfer can be aborted.
+type byteCapper struct {
+	io.Reader
+	n    int64
+	done func()
+
+	hit bool
+}
+
+func (r *byteCapper) Read(b []byte) (n int, err error) {
+	if r.hit {
+		return 0, io.EOF
+	}
+
+	if r.n < 1 {
+		var probe [1]byte
+
+		n, err := io.ReadFull(r.Reader, probe[:])
+		if n > 0 {
+			r.hit = true
+			if r.done != nil {
+				r.done()
+			}
+			return 0, io.EOF
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+
+	if int64(len(b)) > r.n {
+		b = b[:r.n]
+	}
+
+	n, err = r.Reader.Read(b)
+	r.n -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/puellanivis/breton/lib/metrics"
+)
+
+const (
+	labelScheme = metrics.Label("scheme")
+)
+
+var (
+	bwLifetime = metrics.Gauge("bandwidth_lifetime_bps", "bandwidth of the copy to output process (bytes/second)")
+	bwRunning  = metrics.Gauge("bandwidth_running_bps", "bandwidth of the copy to output process (bytes/second)")
+	bwPeak     = metrics.Gauge("bandwidth_peak_bps", "peak running bandwidth of the copy to output process (bytes/second)")
+
+	filesProcessed = metrics.Counter("files_processed_total", "number of files copied to output", metrics.WithLabels(labelScheme))
+	filesFailed    = metrics.Counter("files_failed_total", "number of files that failed to be copied to output", metrics.WithLabels(labelScheme))
+	bytesCopied    = metrics.Counter("bytes_copied_total", "number of bytes copied to output")
+	copySeconds    = metrics.Counter("copy_seconds_total", "time spent copying files to output (seconds)")
+
+	// From a millisecond to over an hour, and from 256 bytes to over 16 GiB, in steps of four.
+	copyDuration = metrics.Histogram("file_copy_duration_seconds", "duration of the copy of each file to output (seconds)", metrics.WithLabels(labelScheme), metrics.ExponentialBuckets(0.001, 4, 12))
+	fileSize     = metrics.Histogram("file_size_bytes", "number of bytes copied to output of each file", metrics.WithLabels(labelScheme), metrics.ExponentialBuckets(256, 4, 14))
+)
+
+// bwRunningObserver is the observer of the running bandwidth metric, if metrics are enabled.
+var bwRunningObserver *peakObserver
+
+// peakObserver passes observations through to an Observer, while also tracking the peak value observed.
+type peakObserver struct {
+	metrics.Observer
+
+	mu   sync.Mutex
+	max  float64
+	peak *metrics.GaugeValue
+}
+
+func (o *peakObserver) Observe(v float64) {
+	o.Observer.Observe(v)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if v > o.max {
+		o.max = v
+		o.peak.Set(v)
+	}
+}
+
+// countingWriter passes writes through to an io.Writer, while counting the bytes written.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (n int, err error) {
+	n, err = w.Writer.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// newMetricsMux returns a new http.ServeMux publishing metrics at the given root path.
+// A dedicated mux is used, so that nothing is registered onto the http.DefaultServeMux.
+// If redirect is set, then all other paths are redirected to the root path.
+func newMetricsMux(root string, redirect bool) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	h := promhttp.Handler()
+
+	mux.Handle(root, h)
+	if !strings.HasSuffix(root, "/") {
+		mux.Handle(root+"/", h)
+	}
+
+	if redirect && root != "/" {
+		mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+			http.Redirect(w, req, root, http.StatusMovedPermanently)
+		})
+	}
+
+	return mux
+}
+
+// listenMetrics listens on the given metrics address.
+//
+// An address of "unix:/path/to.sock" listens on a unix socket, replacing a stale socket file left behind by an earlier run.
+// An address may also be prefixed with "tcp:" to listen on both IPv4 and IPv6, or with "tcp6:" or "tcp4:" to listen on only one.
+// A bracketed IPv6 host, like "[::1]:9090", listens on IPv6, and a plain "host:port" listens on IPv4, as it always has.
+func listenMetrics(addr string) (net.Listener, error) {
+	network := "tcp4"
+
+	if scheme, rest, found := strings.Cut(addr, ":"); found {
+		switch scheme {
+		case "unix":
+			removeStaleSocket(rest)
+			return net.Listen("unix", rest)
+
+		case "tcp", "tcp4", "tcp6":
+			return net.Listen(scheme, rest)
+		}
+	}
+
+	if strings.HasPrefix(addr, "[") {
+		network = "tcp6"
+	}
+
+	return net.Listen(network, addr)
+}
+
+// removeStaleSocket removes the given unix socket file, but only if it is a socket, and nothing is listening on it.
+func removeStaleSocket(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		logger.Warning("removing stale metrics socket: ", err)
+	}
+}
+
+// metricsURL renders where metrics are published at the given root path of a metrics listener, for humans to find it by.
+// A unix socket has no http URL, so it is rendered as the address that it was given as, with the path beside it.
+func metricsURL(addr net.Addr, root string) string {
+	if addr.Network() == "unix" {
+		return fmt.Sprintf("unix:%s, at path %s", addr, root)
+	}
+
+	return fmt.Sprintf("http://%s%s", addr, root)
+}
+
+// schemeOf returns the scheme of the given filename for use as a metrics label.
+func schemeOf(filename string) string {
+	switch filename {
+	case "", "-", "/dev/stdin":
+		return "stdin"
+	}
+
+	if filepath.IsAbs(filename) {
+		return "file"
+	}
+
+	uri, err := url.Parse(filename)
+	if err != nil || uri.Scheme == "" {
+		return "file"
+	}
+
+	return uri.Scheme
+}
+
+// writeMetricsSummary reads back the values of the registered metrics,
+// and writes a human-readable summary of them to the given io.Writer.
+func writeMetricsSummary(w io.Writer) error {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	var files, failed, bytes, seconds, peak float64
+	schemes := make(map[string]float64)
+
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "files_processed_total":
+				v := m.GetCounter().GetValue()
+				files += v
+
+				for _, label := range m.GetLabel() {
+					if label.GetName() == string(labelScheme) {
+						schemes[label.GetValue()] += v
+					}
+				}
+
+			case "files_failed_total":
+				failed += m.GetCounter().GetValue()
+
+			case "bytes_copied_total":
+				bytes += m.GetCounter().GetValue()
+
+			case "copy_seconds_total":
+				seconds += m.GetCounter().GetValue()
+
+			case "bandwidth_peak_bps":
+				peak = m.GetGauge().GetValue()
+			}
+		}
+	}
+
+	var keys []string
+	for scheme := range schemes {
+		keys = append(keys, scheme)
+	}
+	sort.Strings(keys)
+
+	var counts []string
+	for _, scheme := range keys {
+		counts = append(counts, fmt.Sprintf("%s: %.0f", scheme, schemes[scheme]))
+	}
+
+	var avg float64
+	if seconds > 0 {
+		avg = bytes / seconds
+	}
+
+	b := new(strings.Builder)
+
+	fmt.Fprintln(b, "metrics summary:")
+	fmt.Fprintf(b, "  files:     %.0f (%s)\n", files, strings.Join(counts, ", "))
+	fmt.Fprintf(b, "  failed:    %.0f\n", failed)
+	fmt.Fprintf(b, "  bytes:     %.0f\n", bytes)
+	fmt.Fprintf(b, "  bandwidth: %.0f bytes/s average, %.0f bytes/s peak\n", avg, peak)
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
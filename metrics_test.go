@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMux(t *testing.T) {
+	type request struct {
+		path     string
+		code     int
+		location string
+	}
+
+	tests := []struct {
+		name     string
+		root     string
+		redirect bool
+		requests []request
+	}{
+		{
+			name:     "custom root with redirect",
+			root:     "/stats",
+			redirect: true,
+			requests: []request{
+				{path: "/stats", code: http.StatusOK},
+				{path: "/stats/", code: http.StatusOK},
+				{path: "/", code: http.StatusMovedPermanently, location: "/stats"},
+				{path: "/metrics", code: http.StatusMovedPermanently, location: "/stats"},
+				{path: "/statsfoo", code: http.StatusMovedPermanently, location: "/stats"},
+			},
+		},
+		{
+			name: "custom root without redirect",
+			root: "/stats",
+			requests: []request{
+				{path: "/stats", code: http.StatusOK},
+				{path: "/stats/", code: http.StatusOK},
+				{path: "/", code: http.StatusNotFound},
+				{path: "/metrics", code: http.StatusNotFound},
+				{path: "/statsfoo", code: http.StatusNotFound},
+			},
+		},
+		{
+			name:     "root path with redirect",
+			root:     "/",
+			redirect: true,
+			requests: []request{
+				{path: "/", code: http.StatusOK},
+				{path: "/metrics", code: http.StatusOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := newMetricsMux(tt.root, tt.redirect)
+
+			for _, r := range tt.requests {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, r.path, nil))
+
+				if rec.Code != r.code {
+					t.Errorf("GET %s: got status %d, expected %d", r.path, rec.Code, r.code)
+					continue
+				}
+
+				if got := rec.Header().Get("Location"); got != r.location {
+					t.Errorf("GET %s: got Location %q, expected %q", r.path, got, r.location)
+				}
+
+				if r.code == http.StatusOK && !strings.Contains(rec.Body.String(), "# TYPE ") {
+					t.Errorf("GET %s: did not publish metrics: %q", r.path, rec.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package mutate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// fusedLineWriter applies the line-oriented mutators -s, -n, -b, and -E all in a single pass,
+// in the same order the chained mutators would apply them.
+//
+// Rather than each mutator splitting every Write into lines, and writing each piece separately,
+// the lines are scanned once, and the whole transformed Write is assembled into one reused buffer.
+type fusedLineWriter struct {
+	io.WriteCloser
+
+	squeeze  bool
+	number   bool
+	nonblank bool
+	ends     bool
+	format   string
+
+	lineno       int
+	midline      bool
+	lastWasBlank bool
+
+	// cr is set when a CR at the end of a Write was held back, as with -E it might be the start of a CRLF.
+	cr bool
+
+	buf []byte
+}
+
+// fusedBuffers pools the assembly buffers of fusedLineWriters, for when a new chain is built for each file.
+var fusedBuffers = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// FusedConfig selects which of the line-oriented mutators a fused line writer applies.
+type FusedConfig struct {
+	SqueezeBlank   bool
+	Number         bool
+	NumberNonblank bool
+	ShowEnds       bool
+}
+
+// NewFusedLineWriter returns a mutator that applies -s, -n or -b, and -E, as selected, all in a single pass.
+// Its output is the same as that of the chain of NewLineEndMarker, the line numberer, and NewBlankSqueezer.
+func NewFusedLineWriter(w io.WriteCloser, c FusedConfig, opts ...NumberOption) io.WriteCloser {
+	n := newNumbering(opts)
+
+	return &fusedLineWriter{
+		buf:         *fusedBuffers.Get().(*[]byte),
+		WriteCloser: w,
+		squeeze:     c.SqueezeBlank,
+		number:      c.Number || c.NumberNonblank,
+		nonblank:    c.NumberNonblank,
+		ends:        c.ShowEnds,
+		format:      n.format,
+		lineno:      n.lineno,
+	}
+}
+
+// appendLineno appends the line number the same as "%6d\t" would, without going through fmt.
+func appendLineno(b []byte, lineno int) []byte {
+	var digits [20]byte
+	num := strconv.AppendInt(digits[:0], int64(lineno), 10)
+
+	for i := len(num); i < 6; i++ {
+		b = append(b, ' ')
+	}
+
+	b = append(b, num...)
+	return append(b, '\t')
+}
+
+func (w *fusedLineWriter) Write(data []byte) (n int, err error) {
+	out := w.buf[:0]
+
+	for rest := data; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		if w.cr {
+			w.cr = false
+
+			if line[0] == '\n' {
+				out = append(out, '$', '\r', '\n')
+				w.midline = false
+				continue
+			}
+
+			out = append(out, '\r')
+		}
+
+		complete := line[len(line)-1] == '\n'
+		atStart := !w.midline
+		w.midline = !complete
+
+		if atStart {
+			blank := complete && len(line) == 1
+
+			if w.squeeze && blank && w.lastWasBlank {
+				continue
+			}
+			w.lastWasBlank = blank
+
+			if w.number && !(w.nonblank && blank) {
+				w.lineno++
+
+				if w.format == DefaultNumberFormat {
+					out = appendLineno(out, w.lineno)
+				} else {
+					out = fmt.Appendf(out, w.format, w.lineno)
+				}
+			}
+		}
+
+		if w.ends {
+			switch {
+			case complete:
+				body, end := splitLineEnd(line)
+				out = append(out, body...)
+				out = append(out, '$')
+				out = append(out, end...)
+				continue
+
+			case line[len(line)-1] == '\r':
+				out = append(out, line[:len(line)-1]...)
+				w.cr = true
+				continue
+			}
+		}
+
+		out = append(out, line...)
+	}
+
+	w.buf = out
+
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *fusedLineWriter) Close() error {
+	if w.cr {
+		w.cr = false
+
+		if _, err := w.WriteCloser.Write([]byte{'\r'}); err != nil {
+			return err
+		}
+	}
+
+	if w.buf != nil {
+		buf := w.buf[:0]
+		w.buf = nil
+		fusedBuffers.Put(&buf)
+	}
+
+	return w.WriteCloser.Close()
+}
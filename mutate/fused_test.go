@@ -0,0 +1,136 @@
+package mutate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// chainedLineWriter builds the chain of mutators that NewFusedLineWriter is equivalent to, in the same order as allcat builds it.
+func chainedLineWriter(w io.WriteCloser, c FusedConfig, opts ...NumberOption) io.WriteCloser {
+	if c.ShowEnds {
+		w = NewLineEndMarker(w)
+	}
+
+	switch {
+	case c.NumberNonblank:
+		w = NewNonblankLineNumberer(w, opts...)
+	case c.Number:
+		w = NewLineNumberer(w, opts...)
+	}
+
+	if c.SqueezeBlank {
+		w = NewBlankSqueezer(w)
+	}
+
+	return w
+}
+
+// fusedConfigs returns every combination of the mutators that a fused line writer applies.
+func fusedConfigs() []FusedConfig {
+	var configs []FusedConfig
+
+	for i := 0; i < 16; i++ {
+		configs = append(configs, FusedConfig{
+			SqueezeBlank:   i&1 != 0,
+			Number:         i&2 != 0,
+			NumberNonblank: i&4 != 0,
+			ShowEnds:       i&8 != 0,
+		})
+	}
+
+	return configs
+}
+
+func TestFusedLineWriterMatchesChain(t *testing.T) {
+	inputs := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"one line", "hello\n"},
+		{"no final newline", "hello\nworld"},
+		{"blank lines", "a\n\n\n\nb\n\n"},
+		{"only blank lines", "\n\n\n"},
+		{"crlf", "a\r\n\r\n\r\nb\r\n"},
+		{"lone cr", "a\rb\r\nc\r"},
+		{"cr at end", "a\r"},
+		{"mixed", "first\n\n\nsecond\r\n\r\n  \n\tthird\n\n"},
+	}
+
+	opts := []struct {
+		name string
+		opts []NumberOption
+	}{
+		{"default", nil},
+		{"format", []NumberOption{WithNumberFormat("%03d: "), WithStartNumber(10)}},
+	}
+
+	for _, in := range inputs {
+		for _, c := range fusedConfigs() {
+			for _, o := range opts {
+				for _, size := range splitSizes {
+					name := fmt.Sprintf("%s/%+v/%s/split=%d", in.name, c, o.name, size)
+
+					t.Run(name, func(t *testing.T) {
+						want := new(bufferCloser)
+						writeSplit(t, chainedLineWriter(want, c, o.opts...), []byte(in.data), size)
+
+						got := new(bufferCloser)
+						writeSplit(t, NewFusedLineWriter(got, c, o.opts...), []byte(in.data), size)
+
+						if !bytes.Equal(got.Bytes(), want.Bytes()) {
+							t.Errorf("fused output %q, chained output %q", got.Bytes(), want.Bytes())
+						}
+
+						if !got.closed {
+							t.Error("fused line writer did not close the io.WriteCloser it wraps")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// benchmarkInput is a few megabytes of short lines, with runs of blank lines for -s to squeeze.
+func benchmarkInput() []byte {
+	var b bytes.Buffer
+
+	for b.Len() < 4<<20 {
+		b.WriteString("the quick brown fox jumps over the lazy dog\n\n\nsome more text\r\n")
+	}
+
+	return b.Bytes()
+}
+
+func BenchmarkLineWriters(b *testing.B) {
+	data := benchmarkInput()
+	c := FusedConfig{
+		SqueezeBlank: true,
+		Number:       true,
+		ShowEnds:     true,
+	}
+
+	writers := []struct {
+		name string
+		new  func(io.WriteCloser) io.WriteCloser
+	}{
+		{"chained", func(w io.WriteCloser) io.WriteCloser { return chainedLineWriter(w, c) }},
+		{"fused", func(w io.WriteCloser) io.WriteCloser { return NewFusedLineWriter(w, c) }},
+	}
+
+	for _, wr := range writers {
+		for _, size := range []int{4 << 10, 64 << 10} {
+			b.Run(fmt.Sprintf("%s/write=%d", wr.name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(data)))
+
+				for i := 0; i < b.N; i++ {
+					writeSplit(b, wr.new(discardCloser{}), data, size)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package mutate
+
+import (
+	"io"
+	"strconv"
+)
+
+// hexDumper writes out everything written to it as an xxd-style hexdump:
+// each line has the offset, then cols bytes in hex, grouped in pairs, and then those bytes as printable ASCII, or '.'.
+//
+// Writes that do not fall on a line boundary have their remainder held until the line is filled, or until Close.
+type hexDumper struct {
+	io.WriteCloser
+	cols int
+
+	off  int64
+	buf  []byte
+	line []byte
+}
+
+// NewHexDumper returns a mutator that writes an xxd-style hexdump, of cols bytes per line.
+func NewHexDumper(w io.WriteCloser, cols int) io.WriteCloser {
+	return &hexDumper{
+		WriteCloser: w,
+		cols:        cols,
+	}
+}
+
+// hexWidth returns the width of the hex column of a full line, so that a short last line can be padded out to it.
+func (w *hexDumper) hexWidth() int {
+	return w.cols*2 + (w.cols-1)/2
+}
+
+func (w *hexDumper) writeLine(b []byte) error {
+	const digits = "0123456789abcdef"
+
+	line := w.line[:0]
+
+	off := strconv.FormatInt(w.off, 16)
+	for i := len(off); i < 8; i++ {
+		line = append(line, '0')
+	}
+	line = append(line, off...)
+	line = append(line, ':', ' ')
+
+	start := len(line)
+	for i, c := range b {
+		if i > 0 && i%2 == 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, digits[c>>4], digits[c&0xf])
+	}
+	for len(line)-start < w.hexWidth() {
+		line = append(line, ' ')
+	}
+
+	line = append(line, ' ', ' ')
+	for _, c := range b {
+		if c < 32 || c >= 127 {
+			c = '.'
+		}
+		line = append(line, c)
+	}
+	line = append(line, '\n')
+
+	w.line = line
+	w.off += int64(len(b))
+
+	_, err := w.WriteCloser.Write(line)
+	return err
+}
+
+func (w *hexDumper) Write(data []byte) (n int, err error) {
+	b := data
+
+	if len(w.buf) > 0 {
+		take := min(w.cols-len(w.buf), len(b))
+		w.buf = append(w.buf, b[:take]...)
+		b = b[take:]
+
+		if len(w.buf) < w.cols {
+			return len(data), nil
+		}
+
+		if err := w.writeLine(w.buf); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[:0]
+	}
+
+	for len(b) >= w.cols {
+		if err := w.writeLine(b[:w.cols]); err != nil {
+			return len(data) - len(b), err
+		}
+		b = b[w.cols:]
+	}
+
+	w.buf = append(w.buf, b...)
+
+	return len(data), nil
+}
+
+func (w *hexDumper) Close() error {
+	if len(w.buf) > 0 {
+		if err := w.writeLine(w.buf); err != nil {
+			return err
+		}
+		w.buf = w.buf[:0]
+	}
+
+	return w.WriteCloser.Close()
+}
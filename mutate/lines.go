@@ -0,0 +1,416 @@
+package mutate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// lineEndMarker marks the end of each line with a $, as -E does.
+// The $ goes before the whole line terminator, so it is put before the CR of a CRLF.
+//
+// A CR at the end of a Write is held back, until the next Write shows whether it is the start of a CRLF.
+type lineEndMarker struct {
+	io.WriteCloser
+	cr bool
+}
+
+// NewLineEndMarker returns a mutator that marks the end of each line with a $, as cat -E does.
+func NewLineEndMarker(w io.WriteCloser) io.WriteCloser {
+	return &lineEndMarker{
+		WriteCloser: w,
+	}
+}
+
+func (w *lineEndMarker) Write(data []byte) (n int, err error) {
+	if w.cr && len(data) > 0 {
+		w.cr = false
+
+		if data[0] == '\n' {
+			if _, err := w.WriteCloser.Write([]byte("$\r\n")); err != nil {
+				return 0, err
+			}
+
+			data = data[1:]
+			n = 1
+
+		} else if _, err := w.WriteCloser.Write([]byte{'\r'}); err != nil {
+			return 0, err
+		}
+	}
+
+	m, err := EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			if line[len(line)-1] == '\r' {
+				line = line[:len(line)-1]
+				w.cr = true
+			}
+
+			_, err := w.WriteCloser.Write(line)
+			return err
+		}
+
+		body, end := splitLineEnd(line)
+
+		if _, err := w.WriteCloser.Write(body); err != nil {
+			return err
+		}
+		if _, err := w.WriteCloser.Write([]byte{'$'}); err != nil {
+			return err
+		}
+		_, err := w.WriteCloser.Write(end)
+		return err
+	})
+
+	return n + m, err
+}
+
+func (w *lineEndMarker) Close() error {
+	if w.cr {
+		w.cr = false
+
+		if _, err := w.WriteCloser.Write([]byte{'\r'}); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
+
+// lineUniq suppresses consecutive identical lines, like uniq, and with count set, prefixes each line with how many times it repeated, like uniq -c.
+//
+// Lines are compared without their newline, so a final line without one still matches the line before it.
+// Each line is held until a different line shows that its run has ended.
+type lineUniq struct {
+	io.WriteCloser
+	count bool
+
+	prev []byte
+	n    int
+	cur  []byte
+}
+
+// NewLineUniq returns a mutator that suppresses consecutive identical lines, as uniq does,
+// or with count set, that also prefixes each line with how many times it repeated, as uniq -c does.
+func NewLineUniq(w io.WriteCloser, count bool) io.WriteCloser {
+	return &lineUniq{
+		WriteCloser: w,
+		count:       count,
+	}
+}
+
+func (w *lineUniq) flush() error {
+	if w.n < 1 {
+		return nil
+	}
+
+	if w.count {
+		if _, err := fmt.Fprintf(w.WriteCloser, "%7d ", w.n); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.WriteCloser.Write(w.prev)
+	w.n = 0
+	return err
+}
+
+func (w *lineUniq) uniqLine(line []byte) error {
+	if w.n > 0 && bytes.Equal(bytes.TrimSuffix(w.prev, []byte{'\n'}), bytes.TrimSuffix(line, []byte{'\n'})) {
+		w.n++
+		return nil
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	w.prev = append(w.prev[:0], line...)
+	w.n = 1
+	return nil
+}
+
+func (w *lineUniq) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			w.cur = append(w.cur, line...)
+			return nil
+		}
+
+		if len(w.cur) > 0 {
+			line = append(w.cur, line...)
+			w.cur = w.cur[:0]
+		}
+
+		return w.uniqLine(line)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return len(data), nil
+}
+
+func (w *lineUniq) Close() error {
+	if len(w.cur) > 0 {
+		cur := w.cur
+		w.cur = nil
+
+		if err := w.uniqLine(cur); err != nil {
+			return err
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	return w.WriteCloser.Close()
+}
+
+// blankSqueezer suppresses repeated empty output lines, as -s does.
+//
+// It tracks whether it is partway through a line, so that a newline at the start of a Write,
+// which ends a line begun in an earlier Write, is not mistaken for an empty line.
+// This state is kept across files, so a trailing empty line of one file and a leading empty line of the next are squeezed, as cat -s does.
+type blankSqueezer struct {
+	io.WriteCloser
+	lastWasBlank bool
+	midline      bool
+}
+
+// NewBlankSqueezer returns a mutator that suppresses repeated empty lines, as cat -s does.
+func NewBlankSqueezer(w io.WriteCloser) io.WriteCloser {
+	return &blankSqueezer{
+		WriteCloser: w,
+	}
+}
+
+func (w *blankSqueezer) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		atStart := !w.midline
+		w.midline = line[len(line)-1] != '\n'
+
+		if atStart && line[0] == '\n' {
+			if w.lastWasBlank {
+				return nil
+			}
+			w.lastWasBlank = true
+
+		} else if atStart {
+			w.lastWasBlank = false
+		}
+
+		if _, err := w.WriteCloser.Write(line); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+// lineTruncator truncates each line to n bytes, with marker in place of whatever is dropped.
+// The line terminator is always kept, including both bytes of a CRLF.
+//
+// A CR past the limit is held back, until the next byte shows whether it is the start of a CRLF,
+// or just one more byte to drop.
+type lineTruncator struct {
+	io.WriteCloser
+	n      int
+	marker []byte
+
+	col       int
+	truncated bool
+	cr        bool
+}
+
+// NewLineTruncator returns a mutator that truncates each line to n bytes, with marker in place of whatever is dropped.
+func NewLineTruncator(w io.WriteCloser, n int, marker []byte) io.WriteCloser {
+	return &lineTruncator{
+		WriteCloser: w,
+		n:           n,
+		marker:      marker,
+	}
+}
+
+func (w *lineTruncator) truncate() error {
+	if w.truncated {
+		return nil
+	}
+	w.truncated = true
+
+	_, err := w.WriteCloser.Write(w.marker)
+	return err
+}
+
+func (w *lineTruncator) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		body := line
+		eol := line[len(line)-1] == '\n'
+		if eol {
+			body = line[:len(line)-1]
+		}
+
+		if room := w.n - w.col; room > 0 {
+			keep := min(room, len(body))
+			if _, err := w.WriteCloser.Write(body[:keep]); err != nil {
+				return err
+			}
+
+			w.col += keep
+			body = body[keep:]
+		}
+
+		if len(body) > 0 {
+			if w.cr || len(body) > 1 || body[0] != '\r' {
+				if err := w.truncate(); err != nil {
+					return err
+				}
+			}
+
+			w.cr = body[len(body)-1] == '\r'
+		}
+
+		if !eol {
+			return nil
+		}
+
+		end := []byte("\n")
+		if w.cr {
+			end = []byte("\r\n")
+		}
+
+		w.col, w.truncated, w.cr = 0, false, false
+
+		if _, err := w.WriteCloser.Write(end); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (w *lineTruncator) Close() error {
+	// A CR held at the end of the input is not the start of a CRLF, so it was past the limit.
+	if w.cr {
+		if err := w.truncate(); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
+
+type lineEndingNormalizer struct {
+	io.WriteCloser
+	crlf bool
+
+	// lastWasCR records that the last byte seen was a '\r'.
+	// When normalizing to LF, this '\r' is being held back until we know if a '\n' follows it.
+	lastWasCR bool
+}
+
+// NewLineEndingNormalizer returns a mutator that normalizes every line ending to LF, or with crlf set, to CRLF.
+func NewLineEndingNormalizer(w io.WriteCloser, crlf bool) io.WriteCloser {
+	return &lineEndingNormalizer{
+		WriteCloser: w,
+		crlf:        crlf,
+	}
+}
+
+func (w *lineEndingNormalizer) Write(data []byte) (n int, err error) {
+	if w.crlf {
+		return w.writeCRLF(data)
+	}
+
+	return w.writeLF(data)
+}
+
+func (w *lineEndingNormalizer) writeLF(data []byte) (n int, err error) {
+	if len(data) < 1 {
+		return 0, nil
+	}
+
+	if w.lastWasCR {
+		w.lastWasCR = false
+
+		if data[0] != '\n' {
+			if _, err := w.WriteCloser.Write([]byte{'\r'}); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	n, err = EachLine(data, func(line []byte) error {
+		l := len(line)
+
+		switch {
+		case line[l-1] == '\r':
+			// We do not know yet if this '\r' precedes a '\n', so hold it back.
+			line, w.lastWasCR = line[:l-1], true
+
+		case l > 1 && line[l-1] == '\n' && line[l-2] == '\r':
+			if _, err := w.WriteCloser.Write(line[:l-2]); err != nil {
+				return err
+			}
+
+			if _, err := w.WriteCloser.Write([]byte{'\n'}); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		if _, err := w.WriteCloser.Write(line); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (w *lineEndingNormalizer) writeCRLF(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		l := len(line)
+
+		if line[l-1] != '\n' || (l > 1 && line[l-2] == '\r') || (l == 1 && w.lastWasCR) {
+			if _, err := w.WriteCloser.Write(line); err != nil {
+				return err
+			}
+
+			w.lastWasCR = line[l-1] == '\r'
+			return nil
+		}
+
+		if _, err := w.WriteCloser.Write(line[:l-1]); err != nil {
+			return err
+		}
+
+		if _, err := w.WriteCloser.Write([]byte("\r\n")); err != nil {
+			return err
+		}
+
+		w.lastWasCR = false
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (w *lineEndingNormalizer) Close() error {
+	if !w.crlf && w.lastWasCR {
+		w.lastWasCR = false
+
+		if _, err := w.WriteCloser.Write([]byte{'\r'}); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,110 @@
+package mutate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBlankSqueezer(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{
+			name:  "no blank lines",
+			files: []string{"a\nb\n"},
+			want:  "a\nb\n",
+		},
+		{
+			name:  "repeated blank lines",
+			files: []string{"a\n\n\n\nb\n"},
+			want:  "a\n\nb\n",
+		},
+		{
+			name:  "leading blank lines",
+			files: []string{"\n\n\na\n"},
+			want:  "\na\n",
+		},
+		{
+			name:  "only blank lines",
+			files: []string{"\n\n\n"},
+			want:  "\n",
+		},
+		{
+			name:  "blank line across files",
+			files: []string{"a\n\n", "\nb\n"},
+			want:  "a\n\nb\n",
+		},
+		{
+			name:  "blank lines across many files",
+			files: []string{"a\n\n", "\n", "", "\n\n", "b\n"},
+			want:  "a\n\nb\n",
+		},
+		{
+			name:  "line continued across files",
+			files: []string{"a\n\nb", "\n\nc\n"},
+			want:  "a\n\nb\n\nc\n",
+		},
+		{
+			name:  "no final newline",
+			files: []string{"a\n\n\nb"},
+			want:  "a\n\nb",
+		},
+		{
+			name:  "crlf is not blank",
+			files: []string{"a\n\r\n\r\nb\n"},
+			want:  "a\n\r\n\r\nb\n",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, size := range splitSizes {
+			t.Run(fmt.Sprintf("%s/split=%d", tt.name, size), func(t *testing.T) {
+				out := new(bufferCloser)
+				w := NewBlankSqueezer(out)
+
+				// Each file is written in turn to the same squeezer, as allcat does when concatenating them.
+				for _, file := range tt.files {
+					for data := []byte(file); len(data) > 0; {
+						piece := data[:min(size, len(data))]
+
+						n, err := w.Write(piece)
+						if err != nil {
+							t.Fatalf("Write: %v", err)
+						}
+
+						// Even the lines that are squeezed out are reported as written, or io.Copy fails with io.ErrShortWrite.
+						if n != len(piece) {
+							t.Fatalf("Write(%q) = %d, expected %d", piece, n, len(piece))
+						}
+
+						data = data[len(piece):]
+					}
+				}
+
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+
+				if got := out.String(); got != tt.want {
+					t.Errorf("got %q, expected %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestBlankSqueezerCopy(t *testing.T) {
+	out := new(bufferCloser)
+	w := NewBlankSqueezer(out)
+
+	if _, err := strings.NewReader("a\n\n\n\nb\n").WriteTo(w); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	if got, want := out.String(), "a\n\nb\n"; got != want {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Package mutate provides the text transformations of allcat, like those of cat -vETnbs, as composable io.WriteClosers.
+//
+// Each mutator wraps an io.WriteCloser, transforms everything written to it, and writes the result to the wrapped io.WriteCloser.
+// A mutator may hold partial state across Writes, like the start of a line, so it must be closed to flush that state,
+// and closing it also closes the io.WriteCloser it wraps.
+package mutate
+
+import (
+	"bytes"
+)
+
+// EachField calls fn with each field of data, split after every sep,
+// without materializing the fields into a slice.
+// It returns how many bytes of data were in the fields that fn handled without error.
+func EachField(data []byte, sep byte, fn func(field []byte) error) (n int, err error) {
+	for n < len(data) {
+		field := data[n:]
+		if i := bytes.IndexByte(field, sep); i >= 0 {
+			field = field[: i+1 : i+1]
+		}
+
+		if err := fn(field); err != nil {
+			return n, err
+		}
+		n += len(field)
+	}
+	return n, nil
+}
+
+// EachLine calls fn with each line of data, including its trailing newline,
+// without materializing the lines into a slice.
+// It returns how many bytes of data were in the lines that fn handled without error.
+func EachLine(data []byte, fn func(line []byte) error) (n int, err error) {
+	return EachField(data, '\n', fn)
+}
+
+// splitLineEnd splits a complete line into its body, and its line terminator.
+// A CRLF is a single terminator, while a lone CR is not a terminator at all, and stays in the body.
+func splitLineEnd(line []byte) (body, end []byte) {
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		return line[:len(line)-2], line[len(line)-2:]
+	}
+
+	return line[:len(line)-1], line[len(line)-1:]
+}
@@ -0,0 +1,104 @@
+package mutate
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// bufferCloser is an io.WriteCloser that collects everything written to it, for the end of a chain of mutators.
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+// discardCloser is an io.WriteCloser that discards everything written to it, for benchmarks.
+type discardCloser struct{}
+
+func (discardCloser) Write(b []byte) (int, error) { return len(b), nil }
+func (discardCloser) Close() error                { return nil }
+
+// writeSplit writes data to w in pieces of at most size bytes, and then closes it.
+func writeSplit(tb testing.TB, w io.WriteCloser, data []byte, size int) {
+	tb.Helper()
+
+	for len(data) > 0 {
+		n := min(size, len(data))
+
+		if _, err := w.Write(data[:n]); err != nil {
+			tb.Fatalf("Write: %v", err)
+		}
+
+		data = data[n:]
+	}
+
+	if err := w.Close(); err != nil {
+		tb.Fatalf("Close: %v", err)
+	}
+}
+
+// splitSizes are the sizes of the pieces that tests write their input in,
+// so that every mutator is tested with lines, and line endings, split across Writes.
+var splitSizes = []int{1, 2, 3, 7, 64, 1 << 20}
+
+// benchmarkLines is a few megabytes of short lines, as a single Write delivers them.
+func benchmarkLines() []byte {
+	return bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), (4<<20)/44)
+}
+
+// BenchmarkEachLine compares EachLine against splitting the same data into a slice of lines,
+// which allocates the whole slice for every Write.
+func BenchmarkEachLine(b *testing.B) {
+	data := benchmarkLines()
+
+	b.Run("EachLine", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			var lines int
+
+			_, _ = EachLine(data, func(line []byte) error {
+				lines++
+				return nil
+			})
+		}
+	})
+
+	b.Run("SplitAfter", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			var lines int
+
+			for _, line := range bytes.SplitAfter(data, []byte{'\n'}) {
+				if len(line) > 0 {
+					lines++
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkEachField(b *testing.B) {
+	data := bytes.ReplaceAll(benchmarkLines(), []byte{'\n'}, []byte{0})
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var fields int
+
+		_, _ = EachField(data, 0, func(field []byte) error {
+			fields++
+			return nil
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package mutate
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// eachNonprintField calls fn with each field of data, split after every nonprinting byte,
+// without materializing the fields into a slice.
+// It returns how many bytes of data were in the fields that fn handled without error.
+func eachNonprintField(data []byte, fn func(field []byte) error) (n int, err error) {
+	var last int
+	for i := 0; i < len(data); i++ {
+		if data[i] < 32 || data[i] >= 127 {
+			if err := fn(data[last : i+1 : i+1]); err != nil {
+				return last, err
+			}
+			last = i + 1
+		}
+	}
+	if last != len(data) {
+		if err := fn(data[last:]); err != nil {
+			return last, err
+		}
+	}
+	return len(data), nil
+}
+
+type nonprintReplacer struct {
+	io.WriteCloser
+
+	// if utf8 is set, then valid UTF-8 is passed through, and only control code points and invalid bytes are replaced.
+	utf8    bool
+	partial []byte
+	buf     []byte
+}
+
+// NewNonprintReplacer returns a mutator that uses ^ and M- notation, except for LFD and TAB, as cat -v does.
+// With utf8 set, valid UTF-8 is passed through, and only control characters and invalid bytes are replaced.
+func NewNonprintReplacer(w io.WriteCloser, utf8 bool) io.WriteCloser {
+	return &nonprintReplacer{
+		WriteCloser: w,
+		utf8:        utf8,
+	}
+}
+
+// appendNonprint appends the given byte to buf, in ^ and M- notation if it is nonprinting, except for LFD and TAB.
+func appendNonprint(buf []byte, c byte) []byte {
+	switch {
+	case c < 32 && c != '\n' && c != '\t':
+		return append(buf, '^', c+'@')
+	case c < 127:
+		return append(buf, c)
+	case c == 127:
+		return append(buf, '^', '?')
+	case c < 128+32:
+		return append(buf, 'M', '-', '^', c-128+'@')
+	case c == 255:
+		return append(buf, 'M', '-', '^', '?')
+	}
+
+	return append(buf, 'M', '-', c-128)
+}
+
+func (w *nonprintReplacer) Write(data []byte) (n int, err error) {
+	if w.utf8 {
+		return w.writeUTF8(data)
+	}
+
+	ctrl := []byte("^@")
+	meta := []byte("M-^@")
+
+	n, err = eachNonprintField(data, func(field []byte) error {
+		if len(field) < 1 {
+			return nil
+		}
+
+		c, short := field[len(field)-1], field[:len(field)-1]
+
+		switch {
+		case c < 32 && c != '\n' && c != '\t':
+			if _, err := w.WriteCloser.Write(short); err != nil {
+				return err
+			}
+			ctrl[1] = c + '@'
+			if _, err := w.WriteCloser.Write(ctrl); err != nil {
+				return err
+			}
+
+		case c < 127:
+			if _, err := w.WriteCloser.Write(field); err != nil {
+				return err
+			}
+
+		case c == 127:
+			if _, err := w.WriteCloser.Write(short); err != nil {
+				return err
+			}
+			ctrl[1] = '?'
+			if _, err := w.WriteCloser.Write(ctrl); err != nil {
+				return err
+			}
+
+		case c < 128+32:
+			if _, err := w.WriteCloser.Write(short); err != nil {
+				return err
+			}
+			meta[2], meta[3] = '^', c-128+'@'
+			if _, err := w.WriteCloser.Write(meta); err != nil {
+				return err
+			}
+
+		case c == 255:
+			if _, err := w.WriteCloser.Write(short); err != nil {
+				return err
+			}
+			meta[2], meta[3] = '^', '?'
+			if _, err := w.WriteCloser.Write(meta); err != nil {
+				return err
+			}
+
+		default:
+			if _, err := w.WriteCloser.Write(short); err != nil {
+				return err
+			}
+			meta[2] = c - 128
+			if _, err := w.WriteCloser.Write(meta[:3]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+// writeUTF8 decodes runes, passing valid multibyte runes through untouched,
+// and only replacing control code points, and the bytes of invalid UTF-8 sequences.
+// A rune split across Writes is held back until it is complete.
+func (w *nonprintReplacer) writeUTF8(data []byte) (n int, err error) {
+	b := data
+	if len(w.partial) > 0 {
+		b = append(w.partial, data...)
+		w.partial = nil
+	}
+
+	out := w.buf[:0]
+
+	for len(b) > 0 {
+		if b[0] < utf8.RuneSelf {
+			out = appendNonprint(out, b[0])
+			b = b[1:]
+			continue
+		}
+
+		if !utf8.FullRune(b) {
+			w.partial = append([]byte(nil), b...)
+			break
+		}
+
+		r, size := utf8.DecodeRune(b)
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			out = appendNonprint(out, b[0])
+
+		case r < 128+32:
+			// C1 control code points get the same notation as their byte values would.
+			out = appendNonprint(out, byte(r))
+
+		default:
+			out = append(out, b[:size]...)
+		}
+
+		b = b[size:]
+	}
+
+	w.buf = out
+
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *nonprintReplacer) Close() error {
+	if len(w.partial) > 0 {
+		// the input ended partway through a rune, so these bytes are invalid UTF-8.
+		var out []byte
+		for _, c := range w.partial {
+			out = appendNonprint(out, c)
+		}
+		w.partial = nil
+
+		if _, err := w.WriteCloser.Write(out); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
+
+type byteReplacer struct {
+	io.WriteCloser
+	sep  byte
+	with []byte
+}
+
+// NewByteReplacer returns a mutator that replaces every sep byte with the given bytes, as cat -T does for TAB with ^I.
+func NewByteReplacer(w io.WriteCloser, sep byte, with []byte) io.WriteCloser {
+	return &byteReplacer{
+		WriteCloser: w,
+		sep:         sep,
+		with:        with,
+	}
+}
+
+func (w *byteReplacer) Write(data []byte) (n int, err error) {
+	n, err = EachField(data, w.sep, func(field []byte) error {
+		if len(field) < 1 {
+			return nil
+		}
+
+		if field[len(field)-1] != w.sep {
+			if _, err := w.WriteCloser.Write(field); err != nil {
+				return err
+			}
+			return nil
+		}
+
+		if _, err := w.WriteCloser.Write(field[:len(field)-1]); err != nil {
+			return err
+		}
+		if _, err := w.WriteCloser.Write(w.with); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return n, err
+}
@@ -0,0 +1,266 @@
+package mutate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// DefaultNumberFormat is the format that line numbers are written with, the same as cat.
+const DefaultNumberFormat = "%6d\t"
+
+// CheckNumberFormat returns an error unless the given format has exactly one verb, and that verb is an integer verb.
+func CheckNumberFormat(format string) error {
+	var verbs int
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+
+		// skip any flags, width, and precision.
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+
+		if i >= len(format) {
+			return fmt.Errorf("bad number format %q: missing verb at end", format)
+		}
+
+		if format[i] == '%' {
+			continue
+		}
+
+		if strings.IndexByte("bdoOxX", format[i]) < 0 {
+			return fmt.Errorf("bad number format %q: %%%c is not an integer verb", format, format[i])
+		}
+		verbs++
+	}
+
+	if verbs != 1 {
+		return fmt.Errorf("bad number format %q: expected exactly one integer verb, found %d", format, verbs)
+	}
+
+	return nil
+}
+
+// A NumberOption sets how a line numberer numbers lines.
+type NumberOption func(*numbering)
+
+type numbering struct {
+	format string
+	lineno int
+}
+
+func newNumbering(opts []NumberOption) numbering {
+	n := numbering{
+		format: DefaultNumberFormat,
+	}
+
+	for _, opt := range opts {
+		opt(&n)
+	}
+
+	return n
+}
+
+// WithNumberFormat sets the format to number lines with, which must have exactly one integer verb, as CheckNumberFormat checks.
+func WithNumberFormat(format string) NumberOption {
+	return func(n *numbering) {
+		n.format = format
+	}
+}
+
+// WithStartNumber sets the number of the first line numbered.
+func WithStartNumber(start int) NumberOption {
+	return func(n *numbering) {
+		n.lineno = start - 1
+	}
+}
+
+type lineNumberer struct {
+	io.WriteCloser
+	format   string
+	lineno   int
+	suppress bool
+}
+
+// NewLineNumberer returns a mutator that numbers every line, as cat -n does.
+func NewLineNumberer(w io.WriteCloser, opts ...NumberOption) io.WriteCloser {
+	n := newNumbering(opts)
+
+	return &lineNumberer{
+		WriteCloser: w,
+		format:      n.format,
+		lineno:      n.lineno,
+	}
+}
+
+func (w *lineNumberer) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		if !w.suppress {
+			w.lineno++
+			if _, err := fmt.Fprintf(w.WriteCloser, w.format, w.lineno); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.WriteCloser.Write(line); err != nil {
+			return err
+		}
+
+		w.suppress = len(line) < 1 || line[len(line)-1] != '\n'
+
+		return nil
+	})
+
+	return n, err
+}
+
+type nonblankLineNumberer struct {
+	io.WriteCloser
+	format   string
+	lineno   int
+	suppress bool
+}
+
+// NewNonblankLineNumberer returns a mutator that numbers every nonempty line, as cat -b does.
+func NewNonblankLineNumberer(w io.WriteCloser, opts ...NumberOption) io.WriteCloser {
+	n := newNumbering(opts)
+
+	return &nonblankLineNumberer{
+		WriteCloser: w,
+		format:      n.format,
+		lineno:      n.lineno,
+	}
+}
+
+func (w *nonblankLineNumberer) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		if len(line) < 1 || line[0] == '\n' {
+			w.suppress = true
+		}
+
+		if !w.suppress {
+			w.lineno++
+			if _, err := fmt.Fprintf(w.WriteCloser, w.format, w.lineno); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.WriteCloser.Write(line); err != nil {
+			return err
+		}
+
+		w.suppress = len(line) < 1 || line[len(line)-1] != '\n'
+
+		return nil
+	})
+
+	return n, err
+}
+
+// changeNumberer numbers lines like lineNumberer, or nonblankLineNumberer with nonblank set,
+// but leaves the number column blank when a line repeats the line before it.
+//
+// Since a line can only be compared once it is complete, each line is held until its newline is seen.
+type changeNumberer struct {
+	io.WriteCloser
+	nonblank bool
+	format   string
+
+	lineno int
+	cur    []byte
+
+	// prev is the content of the line before, if hasPrev is set, as even an empty line can be repeated.
+	prev    []byte
+	hasPrev bool
+}
+
+// NewChangeNumberer returns a mutator that numbers lines like NewLineNumberer,
+// or with nonblank set, like NewNonblankLineNumberer,
+// but leaves the number blank on a line that repeats the line before it.
+func NewChangeNumberer(w io.WriteCloser, nonblank bool, opts ...NumberOption) io.WriteCloser {
+	n := newNumbering(opts)
+
+	return &changeNumberer{
+		WriteCloser: w,
+		nonblank:    nonblank,
+		format:      n.format,
+		lineno:      n.lineno,
+	}
+}
+
+func (w *changeNumberer) writeLine(line []byte) error {
+	if w.nonblank && line[0] == '\n' {
+		// an unnumbered blank line is still the line before the next one, which then never repeats it.
+		w.hasPrev = false
+
+		_, err := w.WriteCloser.Write(line)
+		return err
+	}
+
+	w.lineno++
+
+	// a final line without a newline still repeats the line before it.
+	content := bytes.TrimSuffix(line, []byte{'\n'})
+
+	num := fmt.Sprintf(w.format, w.lineno)
+
+	if w.hasPrev && bytes.Equal(content, w.prev) {
+		// blank out the number, but keep any whitespace of the format, so the columns still line up.
+		num = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return r
+			}
+			return ' '
+		}, num)
+	}
+
+	if _, err := io.WriteString(w.WriteCloser, num); err != nil {
+		return err
+	}
+
+	w.prev = append(w.prev[:0], content...)
+	w.hasPrev = true
+
+	_, err := w.WriteCloser.Write(line)
+	return err
+}
+
+func (w *changeNumberer) Write(data []byte) (n int, err error) {
+	n, err = EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			w.cur = append(w.cur, line...)
+			return nil
+		}
+
+		if len(w.cur) > 0 {
+			line = append(w.cur, line...)
+			w.cur = w.cur[:0]
+		}
+
+		return w.writeLine(line)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return len(data), nil
+}
+
+func (w *changeNumberer) Close() error {
+	if len(w.cur) > 0 {
+		cur := w.cur
+		w.cur = nil
+
+		if err := w.writeLine(cur); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,101 @@
+package mutate
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestChangeNumberer(t *testing.T) {
+	tests := []struct {
+		name     string
+		nonblank bool
+		squeeze  bool
+		opts     []NumberOption
+		in       string
+		want     string
+	}{
+		{
+			name: "no repeats",
+			in:   "a\nb\nc\n",
+			want: "     1\ta\n     2\tb\n     3\tc\n",
+		},
+		{
+			name: "repeated lines",
+			in:   "a\na\na\nb\na\n",
+			want: "     1\ta\n      \ta\n      \ta\n     4\tb\n     5\ta\n",
+		},
+		{
+			name: "repeat without final newline",
+			in:   "a\na",
+			want: "     1\ta\n      \ta",
+		},
+		{
+			name: "first line blank",
+			in:   "\nb\n",
+			want: "     1\t\n     2\tb\n",
+		},
+		{
+			name: "repeated blank lines",
+			in:   "a\n\n\n\nb\n",
+			want: "     1\ta\n     2\t\n      \t\n      \t\n     5\tb\n",
+		},
+		{
+			name:    "repeated blank lines squeezed",
+			squeeze: true,
+			in:      "a\n\n\n\nb\n",
+			want:    "     1\ta\n     2\t\n     3\tb\n",
+		},
+		{
+			name:    "repeats across squeezed blank lines",
+			squeeze: true,
+			in:      "a\na\n\n\n\na\n",
+			want:    "     1\ta\n      \ta\n     3\t\n     4\ta\n",
+		},
+		{
+			name:     "nonblank",
+			nonblank: true,
+			in:       "a\na\n\nb\nb\n",
+			want:     "     1\ta\n      \ta\n\n     3\tb\n      \tb\n",
+		},
+		{
+			name:     "nonblank does not repeat across a blank line",
+			nonblank: true,
+			in:       "a\n\na\n",
+			want:     "     1\ta\n\n     2\ta\n",
+		},
+		{
+			name:     "nonblank squeezed",
+			nonblank: true,
+			squeeze:  true,
+			in:       "a\na\n\n\n\nb\n",
+			want:     "     1\ta\n      \ta\n\n     3\tb\n",
+		},
+		{
+			name: "format keeps its whitespace",
+			opts: []NumberOption{WithNumberFormat("%03d: "), WithStartNumber(7)},
+			in:   "a\na\nb\n",
+			want: "007: a\n     a\n009: b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		for _, size := range splitSizes {
+			t.Run(fmt.Sprintf("%s/split=%d", tt.name, size), func(t *testing.T) {
+				out := new(bufferCloser)
+
+				// As allcat builds the chain, -s squeezes the lines before they are numbered.
+				var w io.WriteCloser = NewChangeNumberer(out, tt.nonblank, tt.opts...)
+				if tt.squeeze {
+					w = NewBlankSqueezer(w)
+				}
+
+				writeSplit(t, w, []byte(tt.in), size)
+
+				if got := out.String(); got != tt.want {
+					t.Errorf("got %q, expected %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
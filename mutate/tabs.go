@@ -0,0 +1,145 @@
+package mutate
+
+import (
+	"io"
+)
+
+// advance returns the column after the given byte, which is in the given column.
+// Columns are counted in runes, so the continuation bytes of a multibyte rune do not take up a column of their own.
+func advance(col int, c byte) int {
+	switch {
+	case c == '\n':
+		return 0
+	case c&0xC0 == 0x80:
+		// a UTF-8 continuation byte
+		return col
+	}
+
+	return col + 1
+}
+
+// tabExpander replaces each tab with spaces up to the next tab stop, every n columns, like expand.
+//
+// Unlike a byteReplacer, how many spaces a tab becomes depends upon the column it is in,
+// so the column is tracked across Writes, and reset at each newline.
+type tabExpander struct {
+	io.WriteCloser
+	n   int
+	col int
+
+	buf []byte
+}
+
+// NewTabExpander returns a mutator that replaces each TAB with spaces up to the next multiple of n columns, as expand does.
+func NewTabExpander(w io.WriteCloser, n int) io.WriteCloser {
+	return &tabExpander{
+		WriteCloser: w,
+		n:           n,
+	}
+}
+
+func (w *tabExpander) Write(data []byte) (n int, err error) {
+	out := w.buf[:0]
+
+	for _, c := range data {
+		if c != '\t' {
+			out = append(out, c)
+			w.col = advance(w.col, c)
+			continue
+		}
+
+		spaces := w.n - w.col%w.n
+		for i := 0; i < spaces; i++ {
+			out = append(out, ' ')
+		}
+		w.col += spaces
+	}
+
+	w.buf = out
+
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// tabUnexpander replaces runs of spaces that reach a tab stop, every n columns, with a tab, like unexpand -a.
+// A single space before a tab stop is left as a space, and spaces before a tab are absorbed into it.
+//
+// Spaces that have not yet reached a tab stop are held back, even across Writes,
+// until it is known whether they will reach one.
+type tabUnexpander struct {
+	io.WriteCloser
+	n      int
+	col    int
+	spaces int
+
+	buf []byte
+}
+
+// NewTabUnexpander returns a mutator that replaces runs of spaces reaching a multiple of n columns with a TAB, as unexpand -a does.
+func NewTabUnexpander(w io.WriteCloser, n int) io.WriteCloser {
+	return &tabUnexpander{
+		WriteCloser: w,
+		n:           n,
+	}
+}
+
+func (w *tabUnexpander) Write(data []byte) (n int, err error) {
+	out := w.buf[:0]
+
+	for _, c := range data {
+		switch c {
+		case ' ':
+			w.spaces++
+			w.col++
+
+			if w.col%w.n == 0 {
+				if w.spaces > 1 {
+					out = append(out, '\t')
+				} else {
+					out = append(out, ' ')
+				}
+				w.spaces = 0
+			}
+
+		case '\t':
+			out = append(out, '\t')
+			w.col += w.n - w.col%w.n
+			w.spaces = 0
+
+		default:
+			out = w.appendSpaces(out)
+			out = append(out, c)
+			w.col = advance(w.col, c)
+		}
+	}
+
+	w.buf = out
+
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// appendSpaces appends the spaces held back, which did not reach a tab stop.
+func (w *tabUnexpander) appendSpaces(out []byte) []byte {
+	for ; w.spaces > 0; w.spaces-- {
+		out = append(out, ' ')
+	}
+
+	return out
+}
+
+func (w *tabUnexpander) Close() error {
+	if w.spaces > 0 {
+		if _, err := w.WriteCloser.Write(w.appendSpaces(nil)); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/os/user"
+)
+
+// netrcEntry is the login and password of a single machine, or the default, of a .netrc file.
+type netrcEntry struct {
+	login, password string
+}
+
+// netrc is a parsed .netrc file, of the credentials to use for each host, as used by curl, wget, and ftp.
+type netrc struct {
+	machines map[string]*netrcEntry
+	def      *netrcEntry
+}
+
+// parseNetrc parses the content of a .netrc file.
+//
+// Each entry starts with "machine NAME" or "default", and is followed by any of "login NAME", "password SECRET", or "account NAME".
+// A "macdef NAME" defines a macro, which runs until the next blank line, and is skipped.
+func parseNetrc(r io.Reader) (*netrc, error) {
+	n := &netrc{
+		machines: make(map[string]*netrcEntry),
+	}
+
+	var cur *netrcEntry
+	var inMacro bool
+
+	s := bufio.NewScanner(r)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := s.Text()
+
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			token := fields[i]
+
+			if token == "default" {
+				cur = new(netrcEntry)
+				n.def = cur
+				continue
+			}
+
+			if token == "macdef" {
+				inMacro = true
+				break
+			}
+
+			i++
+			if i >= len(fields) {
+				return nil, fmt.Errorf("line %d: %q is missing its value", lineno, token)
+			}
+			value := fields[i]
+
+			switch token {
+			case "machine":
+				cur = new(netrcEntry)
+				n.machines[value] = cur
+				continue
+
+			case "login", "password", "account":
+			default:
+				return nil, fmt.Errorf("line %d: unknown token %q", lineno, token)
+			}
+
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: %q before any machine", lineno, token)
+			}
+
+			switch token {
+			case "login":
+				cur.login = value
+			case "password":
+				cur.password = value
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// loadNetrc reads and parses the given .netrc file.
+func loadNetrc(filename string) (*netrc, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n, err := parseNetrc(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return n, nil
+}
+
+// defaultNetrc returns the path of the .netrc file in the home directory of the current user.
+func defaultNetrc() (string, error) {
+	home, err := user.CurrentHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// lookup returns the entry for the given host, or else the default entry, if any.
+func (n *netrc) lookup(host string) *netrcEntry {
+	if e := n.machines[host]; e != nil {
+		return e
+	}
+
+	return n.def
+}
+
+// credentials are the credentials read from --credentials, or ~/.netrc, if any.
+var credentials *netrc
+
+// withCredentials applies any credentials for the host of the given filename to its open.
+//
+// An http request is sent with basic auth, through the returned context.
+// An sftp or scp URL is returned with the login, and password, to connect as.
+// Credentials given in the URL itself, or by --user or --bearer, override any from the credentials file.
+func withCredentials(ctx context.Context, filename string) (context.Context, string) {
+	if credentials == nil || Flags.User != "" || Flags.Bearer != "" {
+		return ctx, filename
+	}
+
+	scheme := schemeOf(filename)
+	switch scheme {
+	case "http", "https", "sftp", "scp":
+	default:
+		return ctx, filename
+	}
+
+	uri, err := url.Parse(filename)
+	if err != nil || uri.User != nil {
+		return ctx, filename
+	}
+
+	e := credentials.lookup(uri.Hostname())
+	if e == nil || e.login == "" {
+		return ctx, filename
+	}
+
+	switch scheme {
+	case "http", "https":
+		value := "Basic " + base64.StdEncoding.EncodeToString([]byte(e.login+":"+e.password))
+
+		return withAuthorization(ctx, func() (string, error) {
+			return value, nil
+		}), filename
+	}
+
+	uri.User = url.User(e.login)
+	if e.password != "" {
+		uri.User = url.UserPassword(e.login, e.password)
+	}
+
+	return ctx, uri.String()
+}
+
+// redactedError is an error from opening a URL with credentials added to it, with the credentials removed again.
+type redactedError struct {
+	error
+	name, redacted string
+}
+
+func (e *redactedError) Error() string {
+	return strings.ReplaceAll(e.error.Error(), e.name, e.redacted)
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.error
+}
+
+// redactCredentials returns the given error, from opening name in place of filename, without any of the credentials added to name.
+func redactCredentials(err error, name, filename string) error {
+	if err == nil || name == filename {
+		return err
+	}
+
+	return &redactedError{
+		error:    err,
+		name:     name,
+		redacted: filename,
+	}
+}
+
+// withoutUserinfo returns the given name, as returned from the Name of an input, without any login or password in it,
+// as an sftp input returns the URL that it was opened with, including any credentials added to it by withCredentials.
+func withoutUserinfo(name string) string {
+	uri, err := url.Parse(name)
+	if err != nil || uri.User == nil {
+		return name
+	}
+
+	uri.User = nil
+	return uri.String()
+}
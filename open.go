@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// errOpenTimeout is returned when opening a file took longer than --open-timeout.
+var errOpenTimeout = errors.New("open timed out")
+
+// openAsync calls the given open function, but returns as soon as the context is done, or the timeout elapses, if set,
+// even if the open itself is still blocked, as opening a FIFO blocks until its other end is opened.
+//
+// The open function cannot be interrupted, so it is left running, and whatever it eventually opens is closed.
+func openAsync[T io.Closer](ctx context.Context, open func() (T, error), timeout time.Duration) (T, error) {
+	type result struct {
+		f   T
+		err error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		f, err := open()
+		done <- result{f, err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
+	abandon := func() {
+		go func() {
+			if res := <-done; res.err == nil {
+				if err := res.f.Close(); err != nil {
+					logger.Error("abandoned open: Close: ", err)
+				}
+			}
+		}()
+	}
+
+	var zero T
+
+	select {
+	case res := <-done:
+		return res.f, res.err
+
+	case <-ctx.Done():
+		abandon()
+		return zero, ctx.Err()
+
+	case <-expired:
+		abandon()
+		return zero, errOpenTimeout
+	}
+}
+
+// openInput opens the given filename for reading, as files.Open does, but respecting the context, and --open-timeout.
+//
+// Some backends do not make their request until the file is first used,
+// so the file is also probed with a Stat, within the same timeout, and a transient failure of that initial request is returned.
+func openInput(ctx context.Context, filename string, opts ...files.Option) (files.Reader, error) {
+	return openAsync(ctx, func() (files.Reader, error) {
+		in, err := files.Open(ctx, filename, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := in.Stat(); isTransient(err) {
+			in.Close()
+			return nil, err
+		}
+
+		return in, nil
+	}, Flags.OpenTimeout)
+}
+
+// openCatInput opens the given filename as CatFile does: with any credentials for its host,
+// retrying on transient errors up to the given number of retries, and within --open-timeout.
+// Any credentials added to the name that was opened are redacted from a returned error.
+func openCatInput(ctx context.Context, filename string, retries uint, opts ...files.Option) (files.Reader, error) {
+	ctx, openName := withCredentials(ctx, filename)
+
+	in, err := openWithRetry(ctx, openName, retries, Flags.RetryBackoff, opts...)
+	if err != nil {
+		return nil, redactCredentials(err, openName, filename)
+	}
+
+	return in, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// prefetch holds the content of the next file, while the current file is still being written out.
+//
+// Up to limit bytes are buffered in memory, after which writes block until the prefetch is handed off.
+// Once handed off, everything buffered so far is written out, and every later write goes straight through.
+type prefetch struct {
+	mu   sync.Mutex
+	cond sync.Cond
+
+	limit int
+	buf   bytes.Buffer
+	out   io.Writer
+
+	// cancel stops the cat of the file, and done is closed once it has stopped.
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// err is the error, if any, from catting the file.
+	err error
+}
+
+func newPrefetch(limit int, cancel context.CancelFunc) *prefetch {
+	p := &prefetch{
+		limit:  limit,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	p.cond.L = &p.mu
+
+	return p
+}
+
+func (p *prefetch) Write(b []byte) (n int, err error) {
+	p.mu.Lock()
+
+	// A single write larger than the limit is still buffered, if nothing else is.
+	for p.out == nil && p.buf.Len() > 0 && p.buf.Len()+len(b) > p.limit {
+		p.cond.Wait()
+	}
+
+	if out := p.out; out != nil {
+		p.mu.Unlock()
+		return out.Write(b)
+	}
+
+	defer p.mu.Unlock()
+	return p.buf.Write(b)
+}
+
+// handoff writes out everything buffered so far, and then lets all further writes go straight to the given io.Writer.
+func (p *prefetch) handoff(out io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.buf.WriteTo(out)
+	p.buf = bytes.Buffer{}
+
+	p.out = out
+	p.cond.Broadcast()
+
+	return err
+}
+
+// abandon stops the cat of the file, discarding anything of it not yet written out, and waits for it to stop,
+// so that it is never left blocked waiting for a handoff that will not come.
+func (p *prefetch) abandon() {
+	p.cancel()
+
+	if err := p.handoff(io.Discard); err != nil {
+		logger.Error("prefetch: ", err)
+	}
+
+	<-p.done
+}
+
+// CatFilesPrefetched prints the given filenames out to the given io.Writer, one at a time,
+// but opens and starts fetching the next file while the current one is still being written out.
+//
+// Only one file is ever prefetched, and only up to limit bytes of it are buffered before it waits its turn,
+// so files are never reordered, and memory stays bounded.
+//
+// If failFast is set, then it stops at the first file that fails, and returns its error,
+// once whatever was copied of it has been written out.
+// Otherwise, it carries on through every file, and returns the error of the first file that failed, if any.
+//
+// However it returns, it first stops the files still being catted, and discards anything prefetched.
+func CatFilesPrefetched(ctx context.Context, out io.Writer, filenames []string, limit int, failFast bool, opts []files.CopyOption) error {
+	start := func(filename string) *prefetch {
+		ctx, cancel := context.WithCancel(ctx)
+		p := newPrefetch(limit, cancel)
+
+		go func() {
+			defer close(p.done)
+
+			// CatFile reports its own errors.
+			p.err = CatFile(ctx, p, filename, opts)
+		}()
+
+		return p
+	}
+
+	var cur, next *prefetch
+	defer func() {
+		for _, p := range []*prefetch{cur, next} {
+			if p != nil {
+				p.abandon()
+			}
+		}
+	}()
+
+	if len(filenames) > 0 {
+		next = start(filenames[0])
+	}
+
+	var firstErr error
+
+	for i, filename := range filenames {
+		cur, next = next, nil
+
+		if err := cur.handoff(out); err != nil {
+			logger.Errorf("%s: %v", filename, err)
+			return err
+		}
+
+		if i+1 < len(filenames) {
+			next = start(filenames[i+1])
+		}
+
+		select {
+		case <-cur.done:
+		case <-ctx.Done():
+			logger.Error(ctx.Err())
+			return ctx.Err()
+		}
+
+		// A file truncated by --max-bytes is not a failure.
+		if cur.err != nil && cur.err != errTruncated {
+			if failFast {
+				return cur.err
+			}
+
+			if firstErr == nil {
+				firstErr = cur.err
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// inputInfo records the modification time of the input that CatFile opened, for --preserve.
+type inputInfo struct {
+	modTime time.Time
+}
+
+type inputInfoKey struct{}
+
+// withInputInfo returns a context, in which CatFile records the modification time of the input it opens into the returned inputInfo.
+func withInputInfo(ctx context.Context) (context.Context, *inputInfo) {
+	info := new(inputInfo)
+
+	return context.WithValue(ctx, inputInfoKey{}, info), info
+}
+
+// recordInputInfo records the modification time of the given input, if the context asks for it.
+func recordInputInfo(ctx context.Context, in files.Reader) {
+	info, ok := ctx.Value(inputInfoKey{}).(*inputInfo)
+	if !ok {
+		return
+	}
+
+	if fi, err := in.Stat(); err == nil {
+		info.modTime = fi.ModTime()
+	}
+}
+
+// setModTime sets the modification time of the given output filename, which was written through out, once it has been closed.
+//
+// A local file is set with os.Chtimes, and an SFTP file through the client of its connection.
+// The other backends have no way to set the time, and return files.ErrNotSupported.
+func setModTime(out any, filename string, mtime time.Time) error {
+	if path, isLocal := localPath(filename); isLocal {
+		return os.Chtimes(path, mtime, mtime)
+	}
+
+	if ch, ok := out.(interface {
+		Chtimes(atime, mtime time.Time) error
+	}); ok {
+		return ch.Chtimes(mtime, mtime)
+	}
+
+	if c, ok := out.(interface{ GetClient() *sftp.Client }); ok {
+		uri, err := url.Parse(filename)
+		if err != nil {
+			return err
+		}
+
+		if cl := c.GetClient(); cl != nil {
+			return cl.Chtimes(uri.Path, mtime, mtime)
+		}
+	}
+
+	return files.ErrNotSupported
+}
+
+// preserveModTime sets the modification time of the given output to the one recorded from its input, per --preserve.
+// A backend that cannot set times is skipped, as is an input with no modification time.
+func preserveModTime(out any, filename string, info *inputInfo) {
+	if info == nil || info.modTime.IsZero() {
+		if glog.V(2) {
+			logger.Infof("%s: --preserve: no modification time known for the input", filename)
+		}
+		return
+	}
+
+	if err := setModTime(out, filename, info.modTime); err != nil {
+		if !errors.Is(err, files.ErrNotSupported) {
+			logger.Warningf("%s: --preserve: %v", filename, err)
+			return
+		}
+
+		if glog.V(2) {
+			logger.Infof("%s: --preserve: cannot set modification time: %v", filename, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// isTerminal returns true if the given file is a terminal, where it makes sense to redraw a progress line in place.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// observers fans out each observation to all of the observers in it.
+type observers []interface{ Observe(float64) }
+
+func (o observers) Observe(v float64) {
+	for _, obs := range o {
+		obs.Observe(v)
+	}
+}
+
+// formatBytes renders a byte count in IEC units, e.g. "1.5 MiB".
+func formatBytes(n float64) string {
+	const units = "KMGTPE"
+
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+const (
+	progressBarWidth = 20
+	spinner          = `|/-\`
+)
+
+// progress tracks, and periodically renders, the progress of a transfer.
+//
+// Rendering is deferred until the transfer crosses either the minSize or minDuration threshold,
+// so that small or fast transfers never flicker a progress line onto the screen.
+type progress struct {
+	w     io.Writer
+	name  string
+	total int64 // if <= 0, then the total is unknown.
+
+	minSize     int64
+	minDuration time.Duration
+
+	n     atomic.Int64
+	start time.Time
+
+	// rate is the float64 bits of the latest sampled bytes/second, observed through files.WithIntervalBandwidthMetrics.
+	rate atomic.Uint64
+
+	mu    sync.Mutex
+	shown bool
+	spin  int
+}
+
+// Observe records the latest sampled transfer rate in bytes/second.
+func (p *progress) Observe(v float64) {
+	p.rate.Store(math.Float64bits(v))
+}
+
+// bytesPerSecond returns the latest sampled rate,
+// or before the first sample has been taken, the average rate so far.
+func (p *progress) bytesPerSecond(n int64, elapsed time.Duration) float64 {
+	if rate := math.Float64frombits(p.rate.Load()); rate > 0 {
+		return rate
+	}
+
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(n) / elapsed.Seconds()
+}
+
+func newProgress(w io.Writer, name string, total int64) *progress {
+	return &progress{
+		w:     w,
+		name:  name,
+		total: total,
+		start: time.Now(),
+	}
+}
+
+// Reader returns an io.Reader that counts the bytes read from r towards this progress.
+func (p *progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{
+		Reader: r,
+		p:      p,
+	}
+}
+
+type progressReader struct {
+	io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	r.p.n.Add(int64(n))
+	return n, err
+}
+
+// thresholdCrossed returns true if the transfer is large enough or long enough to show progress.
+func (p *progress) thresholdCrossed(n int64, elapsed time.Duration) bool {
+	if p.minSize <= 0 && p.minDuration <= 0 {
+		return true
+	}
+
+	if p.minSize > 0 && n >= p.minSize {
+		return true
+	}
+
+	return p.minDuration > 0 && elapsed >= p.minDuration
+}
+
+func (p *progress) render() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := p.n.Load()
+
+	if !p.shown {
+		if !p.thresholdCrossed(n, time.Since(p.start)) {
+			return
+		}
+
+		p.shown = true
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "\r%s: ", p.name)
+
+	elapsed := time.Since(p.start)
+	rate := p.bytesPerSecond(n, elapsed)
+
+	if p.total > 0 {
+		frac := math.Min(float64(n)/float64(p.total), 1)
+		filled := int(frac * progressBarWidth)
+
+		eta := "--"
+		if rate > 0 {
+			eta = time.Duration(float64(p.total-n) / rate * float64(time.Second)).Round(time.Second).String()
+		}
+
+		fmt.Fprintf(&b, "[%s%s] %5.1f%% %s / %s %s/s ETA %s",
+			strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+			frac*100, formatBytes(float64(n)), formatBytes(float64(p.total)), formatBytes(rate), eta)
+
+	} else {
+		// with no known total, a spinner shows that the transfer is still alive.
+		p.spin = (p.spin + 1) % len(spinner)
+
+		fmt.Fprintf(&b, "%c %s %s/s", spinner[p.spin], formatBytes(float64(n)), formatBytes(rate))
+	}
+
+	// clear whatever was left over from a longer previous line.
+	b.WriteString("\x1b[K")
+
+	io.WriteString(p.w, b.String())
+}
+
+// Run renders the progress at every interval, until the context is done.
+// Once done, it renders a final time (still subject to the thresholds), and ends the line if anything was shown.
+func (p *progress) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.render()
+
+		case <-ctx.Done():
+			p.render()
+
+			p.mu.Lock()
+			shown := p.shown
+			p.mu.Unlock()
+
+			if shown {
+				fmt.Fprintln(p.w)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes of --rate-limit.
+const (
+	rateLimitFile = iota
+	rateLimitTotal
+)
+
+// rateLimiter is a token bucket, which fills at rate bytes per second, up to a second's worth of bytes.
+// It is safe for concurrent use, so that one rateLimiter can be shared by every file being copied at once.
+type rateLimiter struct {
+	mu sync.Mutex
+
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate: float64(rate),
+		last: time.Now(),
+	}
+}
+
+// burst returns the most bytes that a single read should take, which is the capacity of the bucket.
+func (l *rateLimiter) burst() int {
+	return max(1, int(l.rate))
+}
+
+// wait takes n bytes from the bucket, waiting until it has filled enough to be able to do so, or the context is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Taking the bytes now, even into debt, keeps concurrent waiters in order.
+	l.tokens -= float64(n)
+	debt := -l.tokens
+
+	l.mu.Unlock()
+
+	if debt <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(time.Duration(debt / l.rate * float64(time.Second)))
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader paces the reads of an io.Reader to the rate of a rateLimiter.
+//
+// As the copy can only go as fast as it reads, the bandwidth metrics of the copy report the limited rate.
+type throttledReader struct {
+	io.Reader
+	ctx context.Context
+	lim *rateLimiter
+}
+
+func (r *throttledReader) Read(b []byte) (n int, err error) {
+	if burst := r.lim.burst(); len(b) > burst {
+		b = b[:burst]
+	}
+
+	n, err = r.Reader.Read(b)
+
+	if werr := r.lim.wait(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+
+	return n, err
+}
+
+// parseRate parses a rate of bytes per second, given as a size as parseHumanSize takes, with an optional "/s".
+func parseRate(s string) (int64, error) {
+	return parseHumanSize(strings.TrimSuffix(s, "/s"))
+}
+
+// totalRateLimiter is shared by every file, when --rate-limit-scope=total.
+var totalRateLimiter *rateLimiter
+
+// inputRateLimiter returns the rateLimiter to throttle a file with, per --rate-limit, or nil if there is no limit.
+func inputRateLimiter() *rateLimiter {
+	if totalRateLimiter != nil {
+		return totalRateLimiter
+	}
+
+	if inputRate <= 0 {
+		return nil
+	}
+
+	return newRateLimiter(inputRate)
+}
+
+// inputRate is the rate given by --rate-limit, in bytes per second.
+var inputRate int64
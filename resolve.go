@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/files/httpfiles"
+)
+
+// resolveLocal returns the absolute path of the given local filename, with any symlinks resolved.
+func resolveLocal(filename string) string {
+	path, _ := localPath(filename)
+
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
+
+// ResolveFile prints the input filename, what it resolves to, and its size, separated by tabs, to the given io.Writer,
+// without copying any of its content.
+//
+// For http, this is the final URL after following any redirects, and only a HEAD request is made.
+// For a local file, it is the absolute path, with any symlinks resolved.
+// A size of -1 means the backend did not report one.
+func ResolveFile(ctx context.Context, out io.Writer, filename string) error {
+	in, err := files.Open(ctx, filename, httpfiles.WithMethod(http.MethodHead))
+	if err != nil {
+		logger.Error("files.Open: ", err)
+		return err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	info, err := in.Stat()
+	if err != nil {
+		logger.Errorf("%s: %v", filename, err)
+		return err
+	}
+
+	resolved := in.Name()
+
+	switch schemeOf(filename) {
+	case "http", "https":
+		// the name of the request is what was asked for, while the name of its info is from the final response.
+		resolved = info.Name()
+
+	case "file":
+		resolved = resolveLocal(resolved)
+
+	case "stdin":
+		// stdin resolves to nothing more than itself.
+		resolved = filename
+	}
+
+	_, err = fmt.Fprintf(out, "%s\t%s\t%d\n", filename, resolved, info.Size())
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/puellanivis/breton/lib/files/httpfiles"
+)
+
+var errResumeComplete = errors.New("output is already complete")
+
+// resumeOffset returns how many bytes of the given input the given output already holds,
+// and so the offset into the input from which --resume continues the copy.
+//
+// Resuming appends to the output in place, so it must be a local file.
+// The input must be a local or SFTP file, which can be seeked, or an HTTP one, which is sent a Range request.
+// If the output already holds all of the input, then it returns errResumeComplete.
+func resumeOffset(ctx context.Context, output, input string) (int64, error) {
+	path, isLocal := localPath(output)
+	if !isLocal || output == "" || output == "-" || output == "/dev/stdout" {
+		return 0, fmt.Errorf("--resume: %s: only a local output file can be appended to in place", output)
+	}
+
+	switch scheme := schemeOf(input); scheme {
+	case "file", "sftp", "http", "https":
+	default:
+		return 0, fmt.Errorf("--resume: %s: the %s backend cannot be read from an offset", input, scheme)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if info.Size() == 0 {
+		return 0, nil
+	}
+
+	// Only the size of the input is needed, so an http input is only sent a HEAD request, rather than downloading all of it.
+	in, err := openCatInput(ctx, input, Flags.Retries, httpfiles.WithMethod(http.MethodHead))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	src, err := in.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("--resume: %s: cannot tell the size of the input: %w", input, err)
+	}
+
+	switch {
+	case src.Size() <= 0:
+		return 0, fmt.Errorf("--resume: %s: cannot tell the size of the input", input)
+	case info.Size() > src.Size():
+		return 0, fmt.Errorf("--resume: %s: output is larger than the input, %d > %d bytes", output, info.Size(), src.Size())
+	case info.Size() == src.Size():
+		return info.Size(), errResumeComplete
+	}
+
+	return info.Size(), nil
+}
+
+// verifyOutput checks that the whole content of the given output file matches the expected digest.
+func verifyOutput(ctx context.Context, output string, expected *digest) error {
+	sum, _, err := checksumFile(ctx, output, expected.algo, nil)
+	if err != nil {
+		return err
+	}
+
+	actual := &digest{
+		algo: expected.algo,
+		sum:  sum,
+	}
+
+	if actual.String() != expected.String() {
+		return fmt.Errorf("%s: %w: expected %v, got %v", output, errChecksumMismatch, expected, actual)
+	}
+
+	return nil
+}
+
+// isPlainCopy reports whether the content read from an input is copied to the output unchanged, byte for byte,
+// as is required for the size of the output to also be the offset into the input.
+// The out given is the output as wrapped by wrapOutput, and base is the output as it was before, so any mutators are caught as well as any filters.
+func isPlainCopy(out, base io.Writer) bool {
+	switch {
+	case out != base:
+	case Flags.Decompress == decompressAlways, Flags.TrimBytesStart > 0, Flags.TrimBytesEnd > 0, Flags.Extract != "", Flags.Frame != frameNone:
+	case Flags.Head > 0, Flags.Tail > 0, inputLines != nil, Flags.Reverse:
+	case Flags.Base64Decode, Flags.Base64Encode, fromCharset != nil, toCharset != nil, Flags.StripBOM, Flags.AddBOM:
+	case Flags.JSONPretty, Flags.JSONMinify:
+	default:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// maxRetryBackoff caps the exponential backoff, so that a long run of retries does not wait for hours.
+const maxRetryBackoff = 5 * time.Minute
+
+// isTransient returns true if the given error is worth retrying:
+// that is, a network error, or a 5xx or 429 status, rather than for example a 404 or a permission error.
+func isTransient(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission), errors.Is(err, os.ErrInvalid):
+		return false
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	}
+
+	// The s3 backend passes through errors that know their status code, and a statusTransport returns a statusError for the http backend.
+	// This is checked first, as the error of an http request is also a net.Error.
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return isTransientStatus(sc.StatusCode())
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return false
+}
+
+func isTransientStatus(code int) bool {
+	return code >= 500 || code == 429
+}
+
+// retryDelay returns how long to wait before the retry after the given attempt, doubling backoff with each attempt.
+func retryDelay(backoff time.Duration, attempt uint) time.Duration {
+	delay := backoff << attempt
+	if delay <= 0 || delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+
+	return delay
+}
+
+// openWithRetry opens the given filename, retrying on transient errors with exponential backoff.
+// As openInput probes the file, a failure of the initial request of a backend that makes it lazily is retried as well.
+func openWithRetry(ctx context.Context, filename string, retries uint, backoff time.Duration, opts ...files.Option) (files.Reader, error) {
+	for attempt := uint(0); ; attempt++ {
+		in, err := openInput(ctx, filename, opts...)
+		if err == nil {
+			return in, nil
+		}
+
+		if attempt >= retries || !isTransient(err) {
+			return nil, err
+		}
+
+		delay := retryDelay(backoff, attempt)
+
+		if glog.V(2) {
+			logger.Infof("%s: %v; retrying in %v (%d of %d)", filename, err, delay, attempt+1, retries)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"not exist", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, false},
+		{"unexpected eof", fmt.Errorf("read x: %w", io.ErrUnexpectedEOF), true},
+		{"503", &url.Error{Op: "Get", URL: "http://x", Err: &statusError{code: 503, status: "503 Service Unavailable"}}, true},
+		{"429", &statusError{code: 429, status: "429 Too Many Requests"}, true},
+		{"400", &statusError{code: 400, status: "400 Bad Request"}, false},
+		{"status line alone", errors.New("503 Service Unavailable"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient(%v) = %v, expected %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestStatusTransport(t *testing.T) {
+	codes := map[string]int{
+		"/ok":          http.StatusOK,
+		"/unavailable": http.StatusServiceUnavailable,
+		"/missing":     http.StatusNotFound,
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(codes[req.URL.Path])
+	}))
+	defer srv.Close()
+
+	cl := &http.Client{
+		Transport: &statusTransport{
+			RoundTripper: http.DefaultTransport,
+		},
+	}
+
+	for path, code := range codes {
+		resp, err := cl.Get(srv.URL + path)
+
+		if isTransientStatus(code) {
+			var se *statusError
+			if !errors.As(err, &se) || se.StatusCode() != code {
+				t.Errorf("%s: got error %v, expected a statusError of %d", path, err, code)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != code {
+			t.Errorf("%s: got status %d, expected %d", path, resp.StatusCode, code)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/puellanivis/allcat/mutate"
+)
+
+// reverseLines returns the lines of data in reverse order, as tac does.
+//
+// Each line keeps its own newline, so if the last line of data has no trailing newline,
+// then it is emitted first, and runs directly into the line that follows it.
+func reverseLines(data []byte) []byte {
+	var lines [][]byte
+
+	mutate.EachLine(data, func(line []byte) error {
+		lines = append(lines, line)
+		return nil
+	})
+
+	out := make([]byte, 0, len(data))
+	for i := len(lines) - 1; i >= 0; i-- {
+		out = append(out, lines[i]...)
+	}
+
+	return out
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/puellanivis/allcat/mutate"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// sampleRate is how lines are to be sampled.
+// With every set, the first of every that many lines is kept deterministically.
+// Otherwise, each line is kept at random with the probability rate.
+type sampleRate struct {
+	every int
+	rate  float64
+}
+
+// parseSampleRate parses a sample rate given as either "1/N", or a fraction like "0.01".
+func parseSampleRate(sample string) (*sampleRate, error) {
+	if num, denom, found := strings.Cut(sample, "/"); found {
+		n, err := strconv.Atoi(denom)
+		if num != "1" || err != nil || n < 1 {
+			return nil, fmt.Errorf("bad sample %q: expected 1/N", sample)
+		}
+
+		return &sampleRate{every: n}, nil
+	}
+
+	rate, err := strconv.ParseFloat(sample, 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("bad sample %q: expected a fraction in (0, 1]", sample)
+	}
+
+	return &sampleRate{rate: rate}, nil
+}
+
+// lineSampler passes on only a sampled subset of the lines written through it.
+//
+// The decision is made at the start of each line, so lines split across Writes need not be buffered.
+type lineSampler struct {
+	io.WriteCloser
+
+	sampleRate
+	rand *rand.Rand
+
+	lines, kept int64
+
+	midline bool
+	keep    bool
+}
+
+func newLineSampler(out io.WriteCloser, rate *sampleRate, seed int64) *lineSampler {
+	return &lineSampler{
+		WriteCloser: out,
+		sampleRate:  *rate,
+		rand:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (w *lineSampler) startLine() {
+	if w.every > 0 {
+		w.keep = w.lines%int64(w.every) == 0
+	} else {
+		w.keep = w.rand.Float64() < w.rate
+	}
+
+	w.lines++
+	if w.keep {
+		w.kept++
+	}
+}
+
+func (w *lineSampler) Write(data []byte) (n int, err error) {
+	n, err = mutate.EachLine(data, func(line []byte) error {
+		if !w.midline {
+			w.startLine()
+		}
+
+		w.midline = line[len(line)-1] != '\n'
+
+		if !w.keep {
+			return nil
+		}
+
+		if _, err := w.WriteCloser.Write(line); err != nil {
+			return err
+		}
+
+		return nil
+	})
+
+	return n, err
+}
+
+func (w *lineSampler) Close() error {
+	if glog.V(2) && w.lines > 0 {
+		logger.Infof("sampled %d of %d lines: effective sample rate %.4f", w.kept, w.lines, float64(w.kept)/float64(w.lines))
+	}
+
+	return w.WriteCloser.Close()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+var validShellVar = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const heredocDelimiter = "ALLCAT_EOF"
+
+// uniqueDelimiter returns a here-doc delimiter that does not appear as a whole line in the given content.
+// It starts with ALLCAT_EOF, and then tries ALLCAT_EOF_1, ALLCAT_EOF_2, etc.
+func uniqueDelimiter(content []byte) string {
+	seen := make(map[string]bool)
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte(heredocDelimiter)) {
+			seen[string(line)] = true
+		}
+	}
+
+	delim := heredocDelimiter
+	for i := 1; seen[delim]; i++ {
+		delim = heredocDelimiter + "_" + strconv.Itoa(i)
+	}
+
+	return delim
+}
+
+// shellVarWriter buffers all of the content written to it, and then on Close,
+// writes it to the underlying io.Writer as a shell variable assignment using a quoted here-doc:
+//
+//	NAME=$(cat <<'ALLCAT_EOF'
+//	content
+//	ALLCAT_EOF
+//	)
+//
+// As the here-doc delimiter is quoted, nothing in the content is expanded, so nothing needs to be escaped.
+// The delimiter is chosen by scanning the content, so it cannot collide with any line of it.
+// A newline is added before the delimiter if the content does not end in one.
+// As with any command substitution, the shell strips trailing newlines from the assigned value.
+//
+// Close does not close the underlying io.Writer.
+type shellVarWriter struct {
+	w    io.Writer
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *shellVarWriter) Write(b []byte) (n int, err error) {
+	return w.buf.Write(b)
+}
+
+func (w *shellVarWriter) Close() error {
+	content := w.buf.Bytes()
+	delim := uniqueDelimiter(content)
+
+	if _, err := fmt.Fprintf(w.w, "%s=$(cat <<'%s'\n", w.name, delim); err != nil {
+		return err
+	}
+
+	if _, err := w.w.Write(content); err != nil {
+		return err
+	}
+
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		if _, err := w.w.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w.w, "%s\n)\n", delim)
+	return err
+}
+
+// shellVarName returns the variable name to assign the i-th of n files to.
+// A single file is assigned to the name itself, otherwise the files are numbered from 1: NAME_1, NAME_2, etc.
+func shellVarName(name string, i, n int) string {
+	if n == 1 {
+		return name
+	}
+
+	return name + "_" + strconv.Itoa(i+1)
+}
+
+// CatShellVar prints the given filename out to the given io.Writer as a shell variable assignment.
+// Each file gets its own chain of mutators, so that, for example, line numbering starts anew for each variable.
+func CatShellVar(ctx context.Context, out io.Writer, name, filename string, opts []files.CopyOption) error {
+	sv := &shellVarWriter{
+		w:    out,
+		name: name,
+	}
+
+	w := wrapOutput(sv)
+
+	if err := CatFile(ctx, w, filename, opts); err != nil {
+		// do not emit an assignment of partial content.
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+)
+
+// statField is a column of extended metadata shown by --stat, read from each entry of a listing where its backend provides it.
+type statField struct {
+	name string
+	get  func(os.FileInfo) string
+}
+
+// metadataOf returns the entry, or what its Sys returns, as a T, where the backend provides that interface.
+func metadataOf[T any](info os.FileInfo) (T, bool) {
+	if p, ok := info.(*prefixedInfo); ok {
+		info = p.FileInfo
+	}
+
+	if v, ok := info.(T); ok {
+		return v, true
+	}
+
+	v, ok := info.Sys().(T)
+	return v, ok
+}
+
+// statFields are every column of extended metadata that --stat knows how to show, in the order that they are shown.
+var statFields = []statField{
+	{
+		name: "etag",
+		get: func(info os.FileInfo) string {
+			if v, ok := metadataOf[interface{ ETag() string }](info); ok {
+				return v.ETag()
+			}
+			return ""
+		},
+	},
+	{
+		name: "content-type",
+		get: func(info os.FileInfo) string {
+			if v, ok := metadataOf[interface{ ContentType() string }](info); ok {
+				return v.ContentType()
+			}
+			return ""
+		},
+	},
+	{
+		name: "storage-class",
+		get: func(info os.FileInfo) string {
+			if v, ok := metadataOf[interface{ StorageClass() string }](info); ok {
+				return v.StorageClass()
+			}
+			return ""
+		},
+	},
+}
+
+// statColumns returns the statFields that at least one of the given entries has a value for,
+// so that a listing from a backend without any extended metadata gains no empty columns.
+func statColumns(fi []os.FileInfo) []statField {
+	var fields []statField
+
+	for _, field := range statFields {
+		for _, info := range fi {
+			if field.get(info) != "" {
+				fields = append(fields, field)
+				break
+			}
+		}
+	}
+
+	return fields
+}
+
+// statValues renders the values of the given statFields for a single entry, with "-" for any that it has no value for.
+func statValues(info os.FileInfo, fields []statField) []string {
+	cols := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		v := field.get(info)
+		if v == "" {
+			v = "-"
+		}
+
+		cols = append(cols, v)
+	}
+
+	return cols
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// summaryFailure is a single file that failed, as listed by --summary.
+type summaryFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// runSummary accumulates the files catted over a whole run, for --summary.
+//
+// Most files go through CatFile, whether one at a time, or through --jobs or --prefetch, so that is where they are recorded.
+// The paths that open their inputs themselves, such as --verify-checksum, --tar, and --checksum, record their own files.
+type runSummary struct {
+	mu sync.Mutex
+
+	start    time.Time
+	files    int
+	bytes    int64
+	failures []summaryFailure
+}
+
+// summary is the runSummary of --summary, or nil if not set.
+var summary *runSummary
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		start: time.Now(),
+	}
+}
+
+// copied records the bytes copied from a file.
+// It is safe to call on a nil runSummary, which records nothing.
+func (s *runSummary) copied(n int64) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bytes += n
+}
+
+// done records a file as done, and as a failure, if err is not nil.
+// It is safe to call on a nil runSummary, which records nothing.
+func (s *runSummary) done(filename string, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files++
+
+	if err != nil {
+		s.failures = append(s.failures, summaryFailure{
+			File:  filename,
+			Error: err.Error(),
+		})
+	}
+}
+
+// stdoutKeptOpen is stdout as the output, which is left open when it is closed,
+// so that --summary-stdout can still print to it once all of the output has been closed.
+type stdoutKeptOpen struct {
+	*os.File
+}
+
+func (w *stdoutKeptOpen) Close() error {
+	return nil
+}
+
+// failed records a failure of a file that was already recorded as done, such as when its output then fails to close.
+// It is safe to call on a nil runSummary, which records nothing.
+func (s *runSummary) failed(filename string, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, summaryFailure{
+		File:  filename,
+		Error: err.Error(),
+	})
+}
+
+// summaryReport is the summary of a run, as rendered by --summary with --log-format=json.
+type summaryReport struct {
+	Files          int              `json:"files"`
+	Failed         int              `json:"failed"`
+	Bytes          int64            `json:"bytes"`
+	Seconds        float64          `json:"seconds"`
+	BytesPerSecond float64          `json:"bytes_per_second"`
+	Failures       []summaryFailure `json:"failures,omitempty"`
+}
+
+func (s *runSummary) report() *summaryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dur := time.Since(s.start)
+
+	var rate float64
+	if secs := dur.Seconds(); secs > 0 {
+		rate = float64(s.bytes) / secs
+	}
+
+	return &summaryReport{
+		Files:          s.files,
+		Failed:         len(s.failures),
+		Bytes:          s.bytes,
+		Seconds:        dur.Seconds(),
+		BytesPerSecond: rate,
+		Failures:       append([]summaryFailure(nil), s.failures...),
+	}
+}
+
+// write prints the summary out to the given io.Writer, either as a single line of JSON, or to be read by a person.
+func (s *runSummary) write(w io.Writer, asJSON bool) error {
+	r := s.report()
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+
+		return enc.Encode(r)
+	}
+
+	b := new(strings.Builder)
+
+	fmt.Fprintln(b, "summary:")
+	fmt.Fprintf(b, "  files:  %d (%d failed)\n", r.Files, r.Failed)
+	if r.Bytes < 1024 {
+		fmt.Fprintf(b, "  bytes:  %d\n", r.Bytes)
+	} else {
+		fmt.Fprintf(b, "  bytes:  %d (%s)\n", r.Bytes, humanSize(r.Bytes))
+	}
+	fmt.Fprintf(b, "  time:   %v\n", time.Duration(r.Seconds*float64(time.Second)).Round(time.Microsecond))
+	fmt.Fprintf(b, "  rate:   %s/s\n", humanSize(int64(r.BytesPerSecond)))
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(b, "  failures:")
+
+		for _, f := range r.Failures {
+			fmt.Fprintf(b, "    %s: %s\n", f.File, f.Error)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
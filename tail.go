@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io"
+
+	"github.com/puellanivis/allcat/mutate"
+)
+
+// lineTail holds back the last n lines written to it, and only passes them on to the underlying io.Writer when flushed.
+// A final line without a trailing newline still counts as a line.
+type lineTail struct {
+	io.Writer
+	n int
+
+	// lines is a ring of the last complete lines, with next being the index of the oldest.
+	lines [][]byte
+	next  int
+	cur   []byte
+}
+
+func (w *lineTail) push(line []byte) {
+	if len(w.lines) < w.n {
+		w.lines = append(w.lines, append([]byte(nil), line...))
+		return
+	}
+
+	w.lines[w.next] = append(w.lines[w.next][:0], line...)
+	w.next = (w.next + 1) % w.n
+}
+
+func (w *lineTail) Write(data []byte) (n int, err error) {
+	if w.n < 1 {
+		return len(data), nil
+	}
+
+	_, _ = mutate.EachLine(data, func(line []byte) error {
+		if line[len(line)-1] != '\n' {
+			w.cur = append(w.cur, line...)
+			return nil
+		}
+
+		if len(w.cur) > 0 {
+			line = append(w.cur, line...)
+			w.cur = w.cur[:0]
+		}
+
+		w.push(line)
+		return nil
+	})
+
+	return len(data), nil
+}
+
+// flush writes out the last n lines held back.
+func (w *lineTail) flush() error {
+	if len(w.cur) > 0 {
+		w.push(w.cur)
+		w.cur = w.cur[:0]
+	}
+
+	for i := range w.lines {
+		if _, err := w.Writer.Write(w.lines[(w.next+i)%len(w.lines)]); err != nil {
+			return err
+		}
+	}
+
+	w.lines, w.next = w.lines[:0], 0
+	return nil
+}
+
+// seekTail seeks the given input to the start of its last n lines, by reading backwards from the end one block at a time.
+// This avoids reading the whole of a large seekable input, when only its end is wanted.
+//
+// If the input cannot seek at all, it returns false, and nothing has been read.
+func seekTail(in io.ReadSeeker, n int) (bool, error) {
+	end, err := in.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, nil
+	}
+
+	buf := make([]byte, defaultCopyBufferSize)
+
+	var lines int
+	for pos := end; pos > 0; {
+		size := min(int64(len(buf)), pos)
+		pos -= size
+
+		if _, err := in.Seek(pos, io.SeekStart); err != nil {
+			return true, err
+		}
+
+		if _, err := io.ReadFull(in, buf[:size]); err != nil {
+			return true, err
+		}
+
+		for i := size - 1; i >= 0; i-- {
+			// a newline at the very end terminates the last line, rather than starting another.
+			if buf[i] != '\n' || pos+i == end-1 {
+				continue
+			}
+
+			if lines++; lines >= n {
+				_, err := in.Seek(pos+i+1, io.SeekStart)
+				return true, err
+			}
+		}
+	}
+
+	_, err = in.Seek(0, io.SeekStart)
+	return true, err
+}
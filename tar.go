@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// archiveName returns the name to store the given filename under in an archive.
+// Like tar, leading slashes are stripped; URLs are stored under their host and path.
+func archiveName(filename string) string {
+	switch filename {
+	case "", "-", "/dev/stdin":
+		return "stdin"
+	}
+
+	if p, ok := localPath(filename); ok {
+		return strings.TrimLeft(filepath.ToSlash(filepath.Clean(p)), "/")
+	}
+
+	uri, err := url.Parse(filename)
+	if err != nil {
+		return strings.TrimLeft(filename, "/")
+	}
+
+	return strings.TrimLeft(path.Join(uri.Host, uri.Path), "/")
+}
+
+// tarWriter writes files, and directory trees, into a tar stream.
+// Each entry is streamed straight into the tar stream, so huge trees are never buffered,
+// except for files whose size is not known in advance, which must be spooled to learn their size.
+type tarWriter struct {
+	ctx  context.Context
+	tw   *tar.Writer
+	opts []files.CopyOption
+}
+
+func newTarWriter(ctx context.Context, out io.Writer, opts []files.CopyOption) *tarWriter {
+	return &tarWriter{
+		ctx:  ctx,
+		tw:   tar.NewWriter(out),
+		opts: opts,
+	}
+}
+
+// Close writes the tar trailer, but does not close the underlying io.Writer.
+func (t *tarWriter) Close() error {
+	return t.tw.Close()
+}
+
+func fileHeader(info os.FileInfo, name, link string) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr.Name = name
+	if info.IsDir() && !strings.HasSuffix(name, "/") {
+		hdr.Name += "/"
+	}
+
+	return hdr, nil
+}
+
+// Add writes the given filename into the tar stream under the given name, recursing into directories.
+// Errors in a directory tree are reported, and then skipped, like tar does.
+func (t *tarWriter) Add(filename, name string) error {
+	in, err := files.Open(t.ctx, filename)
+	if err != nil {
+		summary.done(filename, err)
+		return err
+	}
+
+	info, err := in.Stat()
+	if err != nil {
+		in.Close()
+		summary.done(filename, err)
+		return err
+	}
+
+	if info.IsDir() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+
+		return t.addDir(filename, name, info)
+	}
+
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	err = t.addFile(in, name, info)
+	summary.done(filename, err)
+
+	return err
+}
+
+func (t *tarWriter) addFile(in io.Reader, name string, info os.FileInfo) error {
+	size := info.Size()
+
+	if !info.Mode().IsRegular() || size <= 0 {
+		// The size is not reliably known, so spool the content to find out.
+		spool, err := os.CreateTemp("", "allcat-tar-*")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			spool.Close()
+			os.Remove(spool.Name())
+		}()
+
+		n, err := pooledCopy(t.ctx, spool, in, t.opts...)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		in, size = spool, n
+	}
+
+	hdr, err := fileHeader(info, name, "")
+	if err != nil {
+		return err
+	}
+	hdr.Typeflag = tar.TypeReg
+	hdr.Mode = int64(info.Mode().Perm())
+	hdr.Size = size
+
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	n, err := pooledCopy(t.ctx, t.tw, in, t.opts...)
+	summary.copied(n)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+func (t *tarWriter) addDir(dirname, name string, info os.FileInfo) error {
+	hdr, err := fileHeader(info, name, "")
+	if err != nil {
+		return err
+	}
+
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	fi, err := files.List(t.ctx, dirname)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(fi, func(i, j int) bool {
+		return fi[i].Name() < fi[j].Name()
+	})
+
+	for _, entry := range fi {
+		child := joinPath(dirname, entry.Name())
+		childName := path.Join(name, entry.Name())
+
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			// Store symlinks as symlinks, rather than following them, which also avoids symlink loops.
+			if err := t.addSymlink(child, childName, entry); err != nil {
+				logger.Errorf("%s: %v", child, err)
+			}
+
+		case entry.IsDir():
+			if err := t.addDir(child, childName, entry); err != nil {
+				logger.Errorf("%s: %v", child, err)
+			}
+
+		default:
+			if err := t.Add(child, childName); err != nil {
+				logger.Errorf("%s: %v", child, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *tarWriter) addSymlink(filename, name string, info os.FileInfo) error {
+	p, ok := localPath(filename)
+	if !ok {
+		return files.ErrNotSupported
+	}
+
+	link, err := os.Readlink(p)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := fileHeader(info, name, link)
+	if err != nil {
+		return err
+	}
+
+	return t.tw.WriteHeader(hdr)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// teeOutput writes everything written to it to the primary output, and to each of its tee targets.
+//
+// Unlike an io.MultiWriter, a write error on a tee target does not stop the others from being written.
+// The error is reported, and the failed target is dropped, while the primary output and the remaining targets carry on.
+// Only a write error on the primary output is returned.
+type teeOutput struct {
+	io.WriteCloser
+
+	tees   []io.WriteCloser
+	names  []string
+	failed []bool
+}
+
+// newTeeOutput opens each of the given tee filenames, as getOutput does, and returns an output that writes to them all.
+func newTeeOutput(ctx context.Context, out io.WriteCloser, filenames []string) (*teeOutput, error) {
+	t := &teeOutput{
+		WriteCloser: out,
+	}
+
+	for _, filename := range filenames {
+		tee, err := getOutput(ctx, filename)
+		if err != nil {
+			for _, tee := range t.tees {
+				tee.Close()
+			}
+
+			return nil, err
+		}
+
+		t.tees = append(t.tees, tee)
+		t.names = append(t.names, filename)
+	}
+
+	t.failed = make([]bool, len(t.tees))
+
+	return t, nil
+}
+
+func (w *teeOutput) Write(data []byte) (n int, err error) {
+	for i, tee := range w.tees {
+		if w.failed[i] {
+			continue
+		}
+
+		if _, err := tee.Write(data); err != nil {
+			logger.Errorf("tee %s: %v; no longer writing to it", w.names[i], err)
+			w.failed[i] = true
+		}
+	}
+
+	return w.WriteCloser.Write(data)
+}
+
+func (w *teeOutput) Close() error {
+	var errs []error
+
+	for i, tee := range w.tees {
+		if err := tee.Close(); err != nil {
+			logger.Errorf("tee %s: %v", w.names[i], err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := w.WriteCloser.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/puellanivis/breton/lib/files"
+	"github.com/puellanivis/breton/lib/glog"
+)
+
+// outputName holds the fields available to an --output-template, describing one input.
+type outputName struct {
+	// Path is the path of the input, without any scheme or host.
+	Path string
+	// Dir is every part of the Path but the last.
+	Dir string
+	// Base is the last part of the Path.
+	Base string
+	// Ext is the extension of the Base, including its dot.
+	Ext string
+	// Stem is the Base without its Ext.
+	Stem string
+	// Index is the position of the input in the inputs, counting from 1.
+	Index int
+}
+
+func newOutputName(filename string, index int) *outputName {
+	p := filename
+	if uri, err := url.Parse(filename); err == nil && uri.Scheme != "" {
+		p = uri.Path
+		if p == "" {
+			p = uri.Opaque
+		}
+	}
+
+	base := path.Base(p)
+	ext := path.Ext(base)
+
+	return &outputName{
+		Path:  p,
+		Dir:   path.Dir(p),
+		Base:  base,
+		Ext:   ext,
+		Stem:  strings.TrimSuffix(base, ext),
+		Index: index,
+	}
+}
+
+// outputTemplate renders a distinct output filename for each input.
+type outputTemplate struct {
+	tmpl *template.Template
+
+	// used maps each output filename rendered so far to the input it was rendered for.
+	used map[string]string
+}
+
+func newOutputTemplate(text string) (*outputTemplate, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("bad --output-template: %w", err)
+	}
+
+	return &outputTemplate{
+		tmpl: tmpl,
+		used: make(map[string]string),
+	}, nil
+}
+
+// render returns the output filename for the given input.
+// It is an error for two inputs to render to the same output filename, rather than have one silently overwrite the other.
+func (t *outputTemplate) render(filename string, index int) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, newOutputName(filename, index)); err != nil {
+		return "", err
+	}
+
+	name := b.String()
+	if name == "" {
+		return "", fmt.Errorf("--output-template rendered an empty filename for %s", filename)
+	}
+
+	if prev, ok := t.used[name]; ok {
+		return "", fmt.Errorf("output %s for %s would overwrite the output for %s", name, filename, prev)
+	}
+	t.used[name] = filename
+
+	return name, nil
+}
+
+// renderAll returns the output filename for each of the given inputs, in order.
+// Every name is rendered before any output is written, so that a collision leaves nothing half done.
+func (t *outputTemplate) renderAll(filenames []string) ([]string, error) {
+	names := make([]string, 0, len(filenames))
+
+	for i, filename := range filenames {
+		name, err := t.render(filename, i+1)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// CatTemplatedFile prints the given filename out to its own file, of the given name, as rendered by an outputTemplate.
+func CatTemplatedFile(ctx context.Context, name, filename string, opts []files.CopyOption) error {
+	dst, err := getOutput(ctx, name)
+	if err != nil {
+		logger.Error("could not open output: ", err)
+		return err
+	}
+
+	enc, err := encodeOutput(dst)
+	if err != nil {
+		logger.Error("could not open output: ", err)
+
+		discardOutput(dst)
+		dst.Close()
+		return err
+	}
+
+	out := wrapOutput(enc)
+
+	var info *inputInfo
+	if Flags.Preserve {
+		ctx, info = withInputInfo(ctx)
+	}
+
+	cerr := CatFile(ctx, out, filename, opts)
+	if cerr != nil {
+		discardOutput(dst)
+	}
+
+	if err := out.Close(); err != nil {
+		logger.Error("output.Close: ", err)
+		return err
+	}
+
+	if cerr == nil && Flags.Preserve {
+		preserveModTime(dst, name, info)
+	}
+
+	if cerr == nil && glog.V(2) {
+		logger.Infof("%s: written to %s", filename, name)
+	}
+
+	return cerr
+}
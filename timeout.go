@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// exitStatus is the status to exit with, once everything else has been closed and flushed.
+var exitStatus int
+
+// reportTimeout reports which file was in progress, if the given error is from --timeout, --stall-timeout, or --open-timeout expiring,
+// and ensures that allcat exits nonzero.
+func reportTimeout(filename string, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Errorf("%s: timed out after --timeout=%v", filename, Flags.Timeout)
+
+	case errors.Is(err, files.ErrWatchdogExpired):
+		logger.Errorf("%s: stalled, with nothing copied for --stall-timeout=%v", filename, Flags.StallTimeout)
+
+	case errors.Is(err, errOpenTimeout):
+		logger.Errorf("%s: could not be opened within --open-timeout=%v", filename, Flags.OpenTimeout)
+
+	default:
+		return
+	}
+
+	exitStatus = 1
+}
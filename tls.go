@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// newTLSConfig returns the TLS configuration for https requests,
+// trusting the certificates of the given PEM bundle in addition to the system roots, if a bundle is given.
+func newTLSConfig(caBundle string, insecureSkipVerify bool) (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caBundle == "" {
+		return conf, nil
+	}
+
+	pem, err := os.ReadFile(caBundle)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: %w", caBundle, errNoCertificates)
+	}
+
+	conf.RootCAs = pool
+
+	return conf, nil
+}
+
+var errNoCertificates = errors.New("no PEM certificates found")
+
+// withTLSConfig returns a context, in which https-based files are requested with the given TLS configuration.
+//
+// This replaces the base transport, so it must be set before any other layer from withTransport.
+func withTLSConfig(ctx context.Context, conf *tls.Config) context.Context {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = conf
+
+	return withTransport(ctx, tr)
+}
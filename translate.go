@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+type runeRange struct {
+	lo, hi rune
+}
+
+// runeSet is a set of runes as given to tr, made up of single runes and ranges, like "a-z0-9_".
+// A leading '^' complements the set, matching every rune not listed.
+type runeSet struct {
+	ranges     []runeRange
+	complement bool
+}
+
+func (s *runeSet) contains(r rune) bool {
+	for _, rr := range s.ranges {
+		if rr.lo <= r && r <= rr.hi {
+			return !s.complement
+		}
+	}
+
+	return s.complement
+}
+
+// expand returns every rune listed in the set, in the order they were listed.
+func (s *runeSet) expand() []rune {
+	var runes []rune
+	for _, rr := range s.ranges {
+		for r := rr.lo; r <= rr.hi; r++ {
+			runes = append(runes, r)
+		}
+	}
+
+	return runes
+}
+
+type setToken struct {
+	r       rune
+	escaped bool
+}
+
+var setEscapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+}
+
+// tokenizeSet splits the given set into runes, resolving backslash escapes.
+// An escaped rune is always literal, so `\-`, `\^`, and `\:` can be used to list those runes themselves.
+func tokenizeSet(s string) ([]setToken, error) {
+	var tokens []setToken
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		if r != '\\' {
+			tokens = append(tokens, setToken{r: r})
+			continue
+		}
+
+		if i >= len(s) {
+			return nil, errors.New("trailing backslash")
+		}
+
+		r, size = utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		if esc, ok := setEscapes[r]; ok {
+			r = esc
+		}
+
+		tokens = append(tokens, setToken{r: r, escaped: true})
+	}
+
+	return tokens, nil
+}
+
+func parseRuneSet(s string) (*runeSet, error) {
+	tokens, err := tokenizeSet(s)
+	if err != nil {
+		return nil, err
+	}
+
+	set := new(runeSet)
+
+	if len(tokens) > 0 && tokens[0] == (setToken{r: '^'}) {
+		set.complement = true
+		tokens = tokens[1:]
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		lo := tokens[i].r
+
+		if i+2 < len(tokens) && tokens[i+1] == (setToken{r: '-'}) {
+			hi := tokens[i+2].r
+			if hi < lo {
+				return nil, fmt.Errorf("range %q-%q is in reverse order", lo, hi)
+			}
+
+			set.ranges = append(set.ranges, runeRange{lo, hi})
+			i += 2
+			continue
+		}
+
+		set.ranges = append(set.ranges, runeRange{lo, lo})
+	}
+
+	return set, nil
+}
+
+// cutSet splits the given string at the first unescaped ':'.
+func cutSet(s string) (before, after string, found bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ':':
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+// translation describes a tr-style translation and deletion of runes.
+type translation struct {
+	del *runeSet
+
+	// with a complemented from set, every rune not in it is translated to the single rune to.
+	from *runeSet
+	to   rune
+
+	mapping map[rune]rune
+}
+
+// newTranslation parses a translation of the form "SET1:SET2", and a set of runes to delete.
+// Either may be empty.
+//
+// As with tr, if SET2 is shorter than SET1, then SET2 is padded out with its last rune.
+func newTranslation(translate, del string) (*translation, error) {
+	t := new(translation)
+
+	if del != "" {
+		set, err := parseRuneSet(del)
+		if err != nil {
+			return nil, fmt.Errorf("bad delete set %q: %w", del, err)
+		}
+
+		t.del = set
+	}
+
+	if translate != "" {
+		set1, set2, found := cutSet(translate)
+		if !found {
+			return nil, fmt.Errorf("bad translation %q: expected SET1:SET2", translate)
+		}
+
+		from, err := parseRuneSet(set1)
+		if err != nil {
+			return nil, fmt.Errorf("bad translation set %q: %w", set1, err)
+		}
+
+		to, err := parseRuneSet(set2)
+		if err != nil {
+			return nil, fmt.Errorf("bad translation set %q: %w", set2, err)
+		}
+
+		if to.complement {
+			return nil, fmt.Errorf("bad translation set %q: cannot complement SET2", set2)
+		}
+
+		dst := to.expand()
+		if len(dst) < 1 {
+			return nil, fmt.Errorf("bad translation %q: SET2 is empty", translate)
+		}
+
+		if from.complement {
+			t.from = from
+			t.to = dst[len(dst)-1]
+
+		} else {
+			t.mapping = make(map[rune]rune)
+
+			for i, r := range from.expand() {
+				if i >= len(dst) {
+					i = len(dst) - 1
+				}
+
+				// As with tr, the last mapping given for a rune wins.
+				t.mapping[r] = dst[i]
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// apply returns what the given rune is translated to, or false if it is to be deleted.
+func (t *translation) apply(r rune) (rune, bool) {
+	if t.del != nil && t.del.contains(r) {
+		return 0, false
+	}
+
+	if t.from != nil && t.from.contains(r) {
+		return t.to, true
+	}
+
+	if to, ok := t.mapping[r]; ok {
+		return to, true
+	}
+
+	return r, true
+}
+
+// runeTranslator applies a translation to everything written through it.
+//
+// A multibyte rune split across Writes is held back until it is complete.
+// Bytes that are not valid UTF-8 are passed through untouched.
+type runeTranslator struct {
+	io.WriteCloser
+	t *translation
+
+	partial []byte
+	buf     []byte
+}
+
+func (w *runeTranslator) Write(data []byte) (n int, err error) {
+	b := data
+	if len(w.partial) > 0 {
+		b = append(w.partial, data...)
+		w.partial = nil
+	}
+
+	out := w.buf[:0]
+
+	for len(b) > 0 {
+		if !utf8.FullRune(b) {
+			w.partial = append([]byte(nil), b...)
+			break
+		}
+
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			out = append(out, b[0])
+			b = b[1:]
+			continue
+		}
+
+		if r, ok := w.t.apply(r); ok {
+			out = utf8.AppendRune(out, r)
+		}
+
+		b = b[size:]
+	}
+
+	w.buf = out
+
+	if _, err := w.WriteCloser.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (w *runeTranslator) Close() error {
+	if len(w.partial) > 0 {
+		partial := w.partial
+		w.partial = nil
+
+		if _, err := w.WriteCloser.Write(partial); err != nil {
+			return err
+		}
+	}
+
+	return w.WriteCloser.Close()
+}
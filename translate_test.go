@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseRuneSet(t *testing.T) {
+	tests := []struct {
+		set      string
+		in, out  string
+		wantErr  bool
+		expanded string
+	}{
+		{set: "abc", in: "abc", out: "xyz", expanded: "abc"},
+		{set: "a-e", in: "abcde", out: "fxyz", expanded: "abcde"},
+		{set: "a-c0-2", in: "abc012", out: "d3", expanded: "abc012"},
+		{set: "α-γ", in: "αβγ", out: "δa", expanded: "αβγ"},
+		{set: "^a-c", in: "dé\n", out: "abc", expanded: "abc"},
+		{set: `\^x`, in: "^x", out: "a", expanded: "^x"},
+		{set: `a\-c`, in: "a-c", out: "b", expanded: "a-c"},
+		{set: "-ab", in: "-ab", out: "c", expanded: "-ab"},
+		{set: "ab-", in: "ab-", out: "c", expanded: "ab-"},
+		{set: `\n\t\\`, in: "\n\t\\", out: "n", expanded: "\n\t\\"},
+		{set: "z-a", wantErr: true},
+		{set: `ab\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.set, func(t *testing.T) {
+			set, err := parseRuneSet(tt.set)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseRuneSet(%q) = %v, expected an error", tt.set, set)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRuneSet(%q): %v", tt.set, err)
+			}
+
+			for _, r := range tt.in {
+				if !set.contains(r) {
+					t.Errorf("set %q does not contain %q", tt.set, r)
+				}
+			}
+
+			for _, r := range tt.out {
+				if set.contains(r) {
+					t.Errorf("set %q contains %q", tt.set, r)
+				}
+			}
+
+			if got := string(set.expand()); got != tt.expanded {
+				t.Errorf("set %q expanded to %q, expected %q", tt.set, got, tt.expanded)
+			}
+		})
+	}
+}
+
+func TestRuneTranslator(t *testing.T) {
+	tests := []struct {
+		name      string
+		translate string
+		del       string
+		in        string
+		want      string
+	}{
+		{"upper", "a-z:A-Z", "", "hello, world\n", "HELLO, WORLD\n"},
+		{"padded", "a-e:xy", "", "abcdef", "xyyyyf"},
+		{"last mapping wins", "aa:xy", "", "a", "y"},
+		{"multibyte from", "αβγ:abc", "", "γβα!", "cba!"},
+		{"multibyte to", "abc:αβγ", "", "cab", "γαβ"},
+		{"multibyte range", "α-ω:Α-Ω", "", "καλημέρα", "ΚΑΛΗΜέΡΑ"},
+		{"complement", "^a-z\n:_", "", "hi there, wörld\n", "hi_there__w_rld\n"},
+		{"delete", "", "aeiou", "translate\n", "trnslt\n"},
+		{"delete multibyte", "", "é", "café olé", "caf ol"},
+		{"delete complement", "", "^0-9\n", "a1b2c3\n", "123\n"},
+		{"delete and translate", "a-z:A-Z", "l", "hello", "HEO"},
+		{"escaped colon", `\::;`, "", "a:b", "a;b"},
+		{"invalid utf8 passes through", "a:b", "", "a\xffa", "b\xffb"},
+		{"cut off rune at end", "a:b", "", "a\xce", "b\xce"},
+	}
+
+	for _, tt := range tests {
+		tr, err := newTranslation(tt.translate, tt.del)
+		if err != nil {
+			t.Fatalf("%s: newTranslation(%q, %q): %v", tt.name, tt.translate, tt.del, err)
+		}
+
+		for _, size := range splitSizes {
+			t.Run(fmt.Sprintf("%s/split=%d", tt.name, size), func(t *testing.T) {
+				out := new(bufferCloser)
+
+				writeSplit(t, &runeTranslator{
+					WriteCloser: out,
+					t:           tr,
+				}, []byte(tt.in), size)
+
+				if got := out.String(); got != tt.want {
+					t.Errorf("got %q, expected %q", got, tt.want)
+				}
+
+				if !out.closed {
+					t.Error("did not close the output it wraps")
+				}
+			})
+		}
+	}
+}
+
+func TestNewTranslationErrors(t *testing.T) {
+	tests := []struct {
+		translate, del string
+	}{
+		{translate: "abc"},
+		{translate: "a-z:"},
+		{translate: "a:^b"},
+		{translate: "z-a:b"},
+		{del: "z-a"},
+	}
+
+	for _, tt := range tests {
+		if _, err := newTranslation(tt.translate, tt.del); err == nil {
+			t.Errorf("newTranslation(%q, %q) did not return an error", tt.translate, tt.del)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+)
+
+// headSkipper discards the first n bytes read from the underlying io.Reader.
+type headSkipper struct {
+	io.Reader
+	n int64
+}
+
+func (r *headSkipper) Read(b []byte) (n int, err error) {
+	if r.n > 0 {
+		skip := r.n
+		r.n = 0
+
+		if _, err := io.CopyN(io.Discard, r.Reader, skip); err != nil {
+			return 0, err
+		}
+	}
+
+	return r.Reader.Read(b)
+}
+
+// tailTrimmer holds back the last n bytes written to it, so that they never reach the underlying io.Writer.
+//
+// As we cannot know which bytes are the last n until the input has ended,
+// a sliding tail of n bytes is always held back, and everything before it is passed through.
+// Close discards the held back tail, and does not close the underlying io.Writer.
+type tailTrimmer struct {
+	io.Writer
+	n    int
+	tail []byte
+}
+
+func (w *tailTrimmer) Write(data []byte) (n int, err error) {
+	if len(data) >= w.n {
+		// everything held back so far, and all but the last n bytes of data can be flushed.
+		if len(w.tail) > 0 {
+			if _, err := w.Writer.Write(w.tail); err != nil {
+				return 0, err
+			}
+		}
+
+		cut := len(data) - w.n
+
+		written, err := w.Writer.Write(data[:cut])
+		if err != nil {
+			return written, err
+		}
+
+		w.tail = append(w.tail[:0], data[cut:]...)
+		return len(data), nil
+	}
+
+	// only the oldest bytes of the tail can be flushed.
+	if over := len(w.tail) + len(data) - w.n; over > 0 {
+		if _, err := w.Writer.Write(w.tail[:over]); err != nil {
+			return 0, err
+		}
+
+		w.tail = append(w.tail[:0], w.tail[over:]...)
+	}
+
+	w.tail = append(w.tail, data...)
+	return len(data), nil
+}
+
+// Close discards the held back tail.
+func (w *tailTrimmer) Close() error {
+	w.tail = w.tail[:0]
+	return nil
+}
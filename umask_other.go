@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// umask is the file mode creation mask of the process, which this platform does not have.
+var umask os.FileMode
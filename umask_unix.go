@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// umask is the file mode creation mask of the process.
+// Reading it means setting it, so it is read once, as the package is initialized, before anything else could be creating files.
+var umask = func() os.FileMode {
+	m := syscall.Umask(0)
+	syscall.Umask(m)
+
+	return os.FileMode(m)
+}()
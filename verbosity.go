@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+
+	flag "github.com/puellanivis/breton/lib/gnuflag"
+)
+
+// verbosity is the count of --verbose, which goes up by one each time that it is given without a value, as with -VV.
+// A value, as with --verbose=3, sets the count directly.
+type verbosity uint
+
+func (v *verbosity) String() string {
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+func (v *verbosity) Set(s string) error {
+	switch s {
+	case "true":
+		*v++
+		return nil
+	case "false":
+		*v = 0
+		return nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return err
+	}
+
+	*v = verbosity(n)
+	return nil
+}
+
+func (v *verbosity) Get() interface{} {
+	return *v
+}
+
+// IsBoolFlag allows --verbose to be given without a value, and in a series of short flags, as with -VV.
+func (v *verbosity) IsBoolFlag() bool {
+	return true
+}
+
+// verbosityLevels are the glog V levels of each count of --verbose:
+// -V logs what each file does, such as bytes copied, and -VV logs each step along the way.
+// Each -V after that raises the V level by one more.
+var verbosityLevels = []uint{0, 2, 5}
+
+// level returns the glog V level of the count of --verbose.
+func (v verbosity) level() uint {
+	last := len(verbosityLevels) - 1
+
+	if int(v) <= last {
+		return verbosityLevels[v]
+	}
+
+	return verbosityLevels[last] + uint(int(v)-last)
+}
+
+// applyVerbosity sets the glog V level from --verbose, if it is given.
+// An explicit --verbosity is left alone, unless --verbose is also given.
+func applyVerbosity(v verbosity) error {
+	if v == 0 {
+		return nil
+	}
+
+	return flag.Set("verbosity", strconv.FormatUint(uint64(v.level()), 10))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// catRange prints the bytes [from, to) of the given filename out to the given io.Writer.
+// It seeks to the start if the file supports it, otherwise it reads and discards up to the start.
+func catRange(ctx context.Context, out io.Writer, filename string, from, to int64, opts []files.CopyOption) (int64, error) {
+	in, err := files.Open(ctx, filename)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := in.Close(); err != nil {
+			logger.Error("input.Close: ", err)
+		}
+	}()
+
+	if from > 0 {
+		if _, err := in.Seek(from, io.SeekStart); err != nil {
+			if _, err := io.CopyN(io.Discard, in, from); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := pooledCopy(ctx, out, io.LimitReader(in, to-from), opts...)
+	if err == io.EOF {
+		err = nil
+	}
+
+	return n, err
+}
+
+// dirWatcher polls directories via files.List, and cats each file that appears in them.
+//
+// This is polling, rather than inotify or similar, as it must work the same across all backends, including SFTP and S3.
+// New files are only noticed at the next poll, and a file is identified only by its name.
+// On the first poll, all files already present are catted.
+type dirWatcher struct {
+	out  io.Writer
+	opts []files.CopyOption
+
+	// if growing is set, then files that grow after they were first catted have their appended bytes catted as well.
+	growing bool
+
+	// seen maps each seen file to how many bytes of it have been catted.
+	seen map[string]int64
+}
+
+func (w *dirWatcher) poll(ctx context.Context, dirname string) {
+	fi, err := files.List(ctx, dirname)
+	if err != nil {
+		logger.Error("files.List: ", err)
+		return
+	}
+
+	sort.Slice(fi, func(i, j int) bool {
+		return fi[i].Name() < fi[j].Name()
+	})
+
+	for _, info := range fi {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		filename := joinPath(dirname, info.Name())
+		done, ok := w.seen[filename]
+
+		switch {
+		case !ok && !w.growing:
+			w.seen[filename] = info.Size()
+			CatFile(ctx, w.out, filename, w.opts)
+
+		case !ok, info.Size() > done && w.growing:
+			// Only cat up to the size listed, so we know exactly where to resume from.
+			n, err := catRange(ctx, w.out, filename, done, info.Size(), w.opts)
+			if err != nil {
+				logger.Errorf("%s: %v", filename, err)
+			}
+
+			w.seen[filename] = done + n
+		}
+	}
+}
+
+// WatchDirs polls the given directories at every interval, and cats each file that appears in them,
+// until the context is done.
+func WatchDirs(ctx context.Context, out io.Writer, dirnames []string, interval time.Duration, growing bool, opts []files.CopyOption) {
+	w := &dirWatcher{
+		out:     out,
+		opts:    opts,
+		growing: growing,
+		seen:    make(map[string]int64),
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		for _, dirname := range dirnames {
+			w.poll(ctx, dirname)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// listXattr returns the names of the extended attributes of the given local path.
+func listXattr(path string) ([]string, error) {
+	sz, err := syscall.Listxattr(path, nil)
+	if err != nil || sz == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, sz)
+
+	sz, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:sz], []byte{0}) {
+		if len(name) < 1 {
+			continue
+		}
+
+		names = append(names, string(name))
+	}
+
+	return names, nil
+}
+
+// getXattr returns the value of the named extended attribute of the given local path.
+func getXattr(path, name string) ([]byte, error) {
+	sz, err := syscall.Getxattr(path, name, nil)
+	if err != nil || sz == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, sz)
+
+	sz, err = syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:sz], nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"github.com/puellanivis/breton/lib/files"
+)
+
+// listXattr is not supported on this platform.
+func listXattr(path string) ([]string, error) {
+	return nil, files.ErrNotSupported
+}
+
+// getXattr is not supported on this platform.
+func getXattr(path, name string) ([]byte, error) {
+	return nil, files.ErrNotSupported
+}